@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/toalaah/vaultsubst/internal/path"
+	"github.com/toalaah/vaultsubst/internal/substitute"
+	"github.com/urfave/cli/v3"
+)
+
+var checkCmd = &cli.Command{
+	Name:      "check",
+	Usage:     "validate templates without writing output",
+	ArgsUsage: "FILE [FILE...]",
+	Action:    runCheckCmd,
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "offline",
+			Value: false,
+			Usage: "only check syntax and transformation names, without contacting vault",
+		},
+	},
+}
+
+// runCheckCmd reports the result of checking each reference in the given files,
+// one line per reference. Secret values are never printed. An error is
+// returned if any reference failed the check.
+func runCheckCmd(ctx context.Context, cmd *cli.Command) error {
+	args, err := parseArgs(cmd)
+	if err != nil {
+		return err
+	}
+	if args == nil {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+
+	if !cmd.Bool("offline") {
+		client, err = newClient(cmd)
+		if err != nil {
+			return err
+		}
+	}
+
+	files, err := collectFiles(args)
+	if err != nil {
+		return err
+	}
+	var total, failed int
+	for _, file := range files {
+		refs, err := checkFile(file)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			total++
+			if ref.Err != nil {
+				failed++
+				fmt.Fprintf(os.Stdout, "%s:%d:%d: %s\n", ref.File, ref.Line, ref.Col, ref.Err)
+				continue
+			}
+			fmt.Fprintf(os.Stdout, "%s:%d:%d: ok %s\n", ref.File, ref.Line, ref.Col, ref.Spec)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d references failed", failed, total)
+	}
+	return nil
+}
+
+// collectFiles expands the directories in args to the files they contain.
+func collectFiles(args []string) ([]string, error) {
+	var files []string
+	for _, pth := range args {
+		isDir, err := path.IsDir(pth)
+		if err != nil {
+			return nil, err
+		}
+		if !isDir {
+			files = append(files, pth)
+			continue
+		}
+		f, err := walker.Files(pth)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f...)
+	}
+	return files, nil
+}
+
+func checkFile(file string) ([]*substitute.Reference, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return substitute.Check(f, r, client,
+		substitute.WithConcurrency(concurrency),
+		substitute.WithFilename(file),
+		substitute.WithParser(parser),
+		substitute.WithStrict(strict),
+	)
+}
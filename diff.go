@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/toalaah/vaultsubst/internal/substitute"
+	"github.com/toalaah/vaultsubst/internal/vault"
+	"github.com/urfave/cli/v3"
+)
+
+var (
+	// changed counts the files which would be changed in diff mode.
+	changed atomic.Int64
+	// maskDiffs enables masking secret values in diffs.
+	maskDiffs bool
+)
+
+// minMaskLen is the minimum length of secret values masked in the existing
+// contents of output files. Shorter values are left as is, since masking them
+// would garble unrelated text.
+const minMaskLen = 4
+
+// diffFile returns a unified diff between the current contents of file and
+// its patched contents, which is empty if the file would not change. In output
+// directory mode, the patched contents are compared to the current contents
+// of out instead, which may not exist yet.
+//
+// If enabled, substituted secrets are masked in the patched contents. In
+// output directory mode, the secrets read for file are also masked in the
+// removed lines of the current contents, which may contain them as well.
+func diffFile(file, out string) ([]byte, error) {
+	orig, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		mu     sync.Mutex
+		values []string
+	)
+	redact := redactor
+	if maskDiffs {
+		redact = func(_ *vault.SecretSpec, v string) string {
+			mu.Lock()
+			defer mu.Unlock()
+			values = append(values, v)
+			return v
+		}
+	}
+	b, err := patch(orig, file, redact)
+	if err != nil {
+		return nil, err
+	}
+	cur, target := orig, file
+	if out != "" {
+		target = out
+		cur, err = os.ReadFile(out)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	if bytes.Equal(cur, b) {
+		return nil, nil
+	}
+	changed.Add(1)
+
+	d := &unifiedDiff{a: splitLines(string(cur)), b: splitLines(string(b)), file: target}
+	d.shown = d.b
+	if maskDiffs {
+		// Secrets are read from the client's cache, masking preserves line
+		// breaks such that the lines correspond to those of b.
+		masked, err := patch(orig, file, substitute.RedactMask)
+		if err != nil {
+			return nil, err
+		}
+		d.shown = splitLines(string(masked))
+		if out != "" {
+			d.maskRemoved = func(line string) string { return maskValues(line, values) }
+		}
+	}
+	return []byte(d.String()), nil
+}
+
+// patch patches the contents orig of file using redact.
+func patch(orig []byte, file string, redact substitute.Redactor) ([]byte, error) {
+	return substitute.PatchSecrets(bytes.NewReader(orig), r, client,
+		substitute.WithConcurrency(concurrency),
+		substitute.WithFilename(file),
+		substitute.WithRedactor(redact),
+		substitute.WithParser(parser),
+		substitute.WithStrict(strict),
+	)
+}
+
+// unifiedDiff is a unified diff between lines a and b of file. The diff is
+// computed on a and b, but lines of b are printed from shown, which holds the
+// same lines as b with secrets masked.
+type unifiedDiff struct {
+	a, b, shown []string
+	file        string
+	// maskRemoved masks removed lines if non-nil.
+	maskRemoved func(string) string
+}
+
+func (d *unifiedDiff) String() string {
+	var w strings.Builder
+	groups := difflib.NewMatcher(d.a, d.b).GetGroupedOpCodes(3)
+	if len(groups) > 0 {
+		fmt.Fprintf(&w, "--- %s\n+++ %s\n", d.file, d.file)
+	}
+	for _, g := range groups {
+		first, last := g[0], g[len(g)-1]
+		fmt.Fprintf(&w, "@@ -%s +%s @@\n", unifiedRange(first.I1, last.I2), unifiedRange(first.J1, last.J2))
+		for _, c := range g {
+			if c.Tag == 'e' {
+				// Equal lines may contain secrets in output directory mode.
+				for _, line := range d.shown[c.J1:c.J2] {
+					writeLine(&w, " ", line)
+				}
+				continue
+			}
+			if c.Tag == 'r' || c.Tag == 'd' {
+				for _, line := range d.a[c.I1:c.I2] {
+					if d.maskRemoved != nil {
+						line = d.maskRemoved(line)
+					}
+					writeLine(&w, "-", line)
+				}
+			}
+			if c.Tag == 'r' || c.Tag == 'i' {
+				for _, line := range d.shown[c.J1:c.J2] {
+					writeLine(&w, "+", line)
+				}
+			}
+		}
+	}
+	return w.String()
+}
+
+// writeLine writes line prefixed with prefix, terminating it with a line break
+// if it has none, which is only the case for the last line of a file.
+func writeLine(w *strings.Builder, prefix, line string) {
+	w.WriteString(prefix + line)
+	if !strings.HasSuffix(line, "\n") {
+		w.WriteString("\n")
+	}
+}
+
+// splitLines splits s into lines, keeping their line breaks.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// unifiedRange formats the range of lines [start, stop) as in unified diff
+// hunk headers.
+func unifiedRange(start, stop int) string {
+	switch n := stop - start; n {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	default:
+		return fmt.Sprintf("%d,%d", start+1, n)
+	}
+}
+
+// maskValues masks all occurrences of values of at least minMaskLen bytes in
+// s, preferring longer values.
+func maskValues(s string, values []string) string {
+	values = slices.Clone(values)
+	slices.SortFunc(values, func(a, b string) int { return cmp.Compare(len(b), len(a)) })
+	var oldnew []string
+	for _, v := range values {
+		if len(v) >= minMaskLen {
+			oldnew = append(oldnew, v, substitute.RedactMask(nil, v))
+		}
+	}
+	return strings.NewReplacer(oldnew...).Replace(s)
+}
+
+// diffResult returns the error for a run in diff mode, encoding its outcome in
+// the exit code: 2 if any file could not be processed, 1 if any file would
+// change and 0 otherwise.
+func diffResult(errs []error) error {
+	if len(errs) > 0 {
+		return cli.Exit(errors.Join(errs...), 2)
+	}
+	if n := changed.Load(); n > 0 {
+		fmt.Fprintf(os.Stderr, "%d file(s) would change\n", n)
+		return cli.Exit("", 1)
+	}
+	return nil
+}
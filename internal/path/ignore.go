@@ -0,0 +1,173 @@
+package path
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pattern is a single pattern in .gitignore syntax.
+type pattern struct {
+	re *regexp.Regexp
+	// negate re-includes paths matched by previous patterns.
+	negate bool
+	// dirOnly restricts the pattern to directories.
+	dirOnly bool
+	// anchored patterns are matched against the whole relative path, others
+	// against the base name only.
+	anchored bool
+}
+
+// parsePattern parses a line of an ignore file. False is returned for blank
+// lines and comments.
+func parsePattern(line string) (*pattern, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return nil, false
+	}
+	p := &pattern{}
+	if s, ok := strings.CutPrefix(line, "!"); ok {
+		p.negate, line = true, s
+	} else {
+		line = strings.TrimPrefix(line, `\`)
+	}
+	if s, ok := strings.CutSuffix(line, "/"); ok {
+		p.dirOnly, line = true, s
+	}
+	if strings.Contains(line, "/") {
+		p.anchored, line = true, strings.TrimPrefix(line, "/")
+	}
+	if line == "" {
+		return nil, false
+	}
+	p.re = compileGlob(line)
+	return p, true
+}
+
+// compileGlob compiles glob into a regular expression matching whole paths.
+// Besides the syntax supported by filepath.Match, "**" matches any number of
+// path segments.
+func compileGlob(glob string) *regexp.Regexp {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "/**") && i+3 == len(glob):
+			b.WriteString("/.*")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if s, ok := strings.CutPrefix(class, "!"); ok {
+				class = "^" + s
+			}
+			b.WriteString("[" + class + "]")
+			i += end + 1
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		// Malformed character classes match literally.
+		return regexp.MustCompile("^" + regexp.QuoteMeta(glob) + "$")
+	}
+	return re
+}
+
+// match reports whether the pattern matches rel, a slash-separated path
+// relative to the pattern's base directory.
+func (p *pattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if !p.anchored {
+		rel = rel[strings.LastIndexByte(rel, '/')+1:]
+	}
+	return p.re.MatchString(rel)
+}
+
+// matchAny reports whether any of patterns matches rel.
+func matchAny(patterns []*pattern, rel string, isDir bool) bool {
+	for _, p := range patterns {
+		if p.match(rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignoreFile holds the patterns of an ignore file, which apply to the paths
+// below its directory.
+type ignoreFile struct {
+	name     string
+	dir      string
+	patterns []*pattern
+}
+
+// readIgnoreFile reads the ignore file name in dir. Nil is returned if it does
+// not exist.
+func readIgnoreFile(dir, name string) (*ignoreFile, error) {
+	f, err := os.Open(filepath.Join(dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	i := &ignoreFile{name: name, dir: dir}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		if p, ok := parsePattern(s.Text()); ok {
+			i.patterns = append(i.patterns, p)
+		}
+	}
+	return i, s.Err()
+}
+
+// ignored reports whether path is ignored, along with the name of the ignore
+// file deciding so. Ignore files are applied in order, with the last matching
+// pattern taking precedence.
+func ignored(files []*ignoreFile, path string, isDir bool) (bool, string) {
+	var (
+		res  bool
+		name string
+	)
+	for _, f := range files {
+		rel, err := filepath.Rel(f.dir, path)
+		if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, p := range f.patterns {
+			if p.match(rel, isDir) {
+				res, name = !p.negate, f.name
+			}
+		}
+	}
+	return res, name
+}
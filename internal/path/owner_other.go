@@ -0,0 +1,13 @@
+//go:build !unix
+
+package path
+
+import (
+	"io/fs"
+	"os"
+)
+
+// chown is a no-op on platforms without unix file ownership.
+func chown(*os.File, fs.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,261 @@
+package path
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// IgnoreFile is the name of the ignore file which is always honored when
+// walking directories. It uses the same syntax as .gitignore.
+const IgnoreFile = ".vaultsubstignore"
+
+// binarySniffLen is the number of leading bytes inspected to detect binary
+// files, matching the heuristic used by git.
+const binarySniffLen = 8000
+
+// Walker lists the files below a directory.
+type Walker struct {
+	// Recursive enables descending into subdirectories of the root directory.
+	Recursive bool
+	// Include and Exclude are patterns in .gitignore syntax, matched against
+	// paths relative to the root directory. If Include is non-empty, only
+	// files matching one of its patterns are listed. Files and directories
+	// matching one of the patterns in Exclude are skipped.
+	Include, Exclude []string
+	// GitIgnore enables honoring .gitignore files and skipping .git
+	// directories.
+	GitIgnore bool
+	// FollowSymlinks enables descending into symlinked directories. Symlinks to
+	// files are always listed.
+	FollowSymlinks bool
+	// Confined skips symlinks whose targets are outside of the root directory,
+	// such that the listed files may safely be written to.
+	Confined bool
+	// OutputDir is skipped along with its contents if non-empty, such that
+	// files rendered to it by earlier runs are not processed again.
+	OutputDir string
+	// Skipped is called for each file or directory which is skipped, along
+	// with the reason, if non-nil.
+	Skipped func(path, reason string)
+}
+
+// walk holds the state of a single directory walk.
+type walk struct {
+	*Walker
+	root, realRoot   string
+	include, exclude []*pattern
+	ignoreNames      []string
+	// visited holds the resolved paths of all directories visited so far, in
+	// order to detect symlink loops.
+	visited map[string]bool
+	// outputDir is the resolved absolute path of the output directory, empty
+	// if there is none or it does not exist yet.
+	outputDir string
+	files     []string
+}
+
+// Files returns the paths of all files below root in lexical order. Files
+// ignored by an ignore file or filtered by the walker's patterns are omitted,
+// as are binary files.
+func (w *Walker) Files(root string) ([]string, error) {
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil, err
+	}
+	wk := &walk{
+		Walker:      w,
+		root:        root,
+		realRoot:    realRoot,
+		include:     parsePatterns(w.Include),
+		exclude:     parsePatterns(w.Exclude),
+		ignoreNames: []string{IgnoreFile},
+		visited:     map[string]bool{realRoot: true},
+	}
+	if w.GitIgnore {
+		wk.ignoreNames = append(wk.ignoreNames, ".gitignore")
+	}
+	if w.OutputDir != "" {
+		wk.outputDir = absEvalSymlinks(w.OutputDir)
+	}
+	if err := wk.dir(root, nil); err != nil {
+		return nil, err
+	}
+	return wk.files, nil
+}
+
+// dir lists the files in dir, applying the ignore files of its parent
+// directories.
+func (wk *walk) dir(dir string, ignores []*ignoreFile) error {
+	// Copy such that sibling directories do not share ignore files.
+	ignores = slices.Clip(ignores)
+	for _, name := range wk.ignoreNames {
+		f, err := readIgnoreFile(dir, name)
+		if err != nil {
+			return err
+		}
+		if f != nil {
+			ignores = append(ignores, f)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		path := filepath.Join(dir, e.Name())
+		isDir, target, reason := wk.resolve(path, e)
+		if isDir && !wk.Recursive {
+			// Only iterate the files in the root if recursion is disabled.
+			continue
+		}
+		if reason == "" && isDir && wk.outputDir != "" && absEvalSymlinks(target) == wk.outputDir {
+			reason = "output directory"
+		}
+		if reason == "" {
+			reason = wk.skip(path, e.Name(), isDir, ignores)
+		}
+		if reason != "" {
+			if wk.Skipped != nil {
+				wk.Skipped(path, reason)
+			}
+			continue
+		}
+		if !isDir {
+			wk.files = append(wk.files, path)
+			continue
+		}
+		wk.visited[target] = true
+		if err := wk.dir(path, ignores); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve returns whether path, which is described by e, is a directory
+// after resolving symlinks, as well as its resolved path for directories. If
+// path is a symlink which may not be followed, the reason for skipping it is
+// returned as well.
+func (wk *walk) resolve(path string, e fs.DirEntry) (bool, string, string) {
+	if e.Type()&fs.ModeSymlink == 0 {
+		if !e.IsDir() {
+			return false, "", ""
+		}
+		target, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			target = path
+		}
+		return true, target, ""
+	}
+
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false, "", "broken symlink"
+	}
+	fi, err := os.Stat(target)
+	if err != nil {
+		return false, "", "broken symlink"
+	}
+	if wk.Confined && !within(wk.realRoot, target) {
+		return fi.IsDir(), target, "symlink target " + target + " is outside of the root directory"
+	}
+	switch {
+	case !fi.IsDir():
+		return false, target, ""
+	case !wk.FollowSymlinks:
+		return true, target, "symlink to directory"
+	case wk.visited[target]:
+		return true, target, "symlink loop or directory already visited"
+	case within(wk.realRoot, target):
+		// The target is walked under its real path instead, regardless of
+		// whether the symlink sorts before it.
+		return true, target, "symlink to directory below the root directory"
+	}
+	return true, target, ""
+}
+
+// absEvalSymlinks returns the absolute path of path after resolving symlinks,
+// empty if it cannot be resolved.
+func absEvalSymlinks(path string) string {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return ""
+	}
+	abs, err := filepath.Abs(target)
+	if err != nil {
+		return ""
+	}
+	return abs
+}
+
+// within reports whether path is root or below it.
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// skip returns the reason for skipping path, empty if it should not be
+// skipped.
+func (wk *walk) skip(path, name string, isDir bool, ignores []*ignoreFile) string {
+	if wk.GitIgnore && isDir && name == ".git" {
+		return "git directory"
+	}
+	if !isDir && name == IgnoreFile {
+		return "ignore file"
+	}
+	if ok, name := ignored(ignores, path, isDir); ok {
+		return "ignored by " + name
+	}
+
+	rel, err := filepath.Rel(wk.root, path)
+	if err != nil {
+		return ""
+	}
+	rel = filepath.ToSlash(rel)
+	if matchAny(wk.exclude, rel, isDir) {
+		return "excluded"
+	}
+	if isDir {
+		return ""
+	}
+	if len(wk.include) > 0 && !matchAny(wk.include, rel, false) {
+		return "not included"
+	}
+	if binary, err := isBinary(path); err == nil && binary {
+		return "binary file"
+	}
+	return ""
+}
+
+func parsePatterns(globs []string) []*pattern {
+	var patterns []*pattern
+	for _, g := range globs {
+		if p, ok := parsePattern(g); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// isBinary reports whether the file at path is binary, i.e. contains a NUL
+// byte within its leading bytes.
+func isBinary(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	buf := make([]byte, binarySniffLen)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, err
+	}
+	return bytes.IndexByte(buf[:n], 0) >= 0, nil
+}
@@ -0,0 +1,285 @@
+package path_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/path"
+)
+
+func TestWalkerFiles(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, f := range []string{"b.yml", "a.yml", "sub/c.yml", "sub/deeper/d.yml"} {
+		assert.Nil(os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0o755))
+		assert.Nil(os.WriteFile(filepath.Join(dir, f), nil, 0o600))
+	}
+
+	for _, c := range []struct {
+		name        string
+		walker      *path.Walker
+		root        string
+		expectedRes []string
+		expectedErr bool
+	}{
+		{
+			name:        "non-recursive",
+			walker:      &path.Walker{},
+			root:        dir,
+			expectedRes: []string{"a.yml", "b.yml"},
+		},
+		{
+			name:        "recursive",
+			walker:      &path.Walker{Recursive: true},
+			root:        dir,
+			expectedRes: []string{"a.yml", "b.yml", "sub/c.yml", "sub/deeper/d.yml"},
+		},
+		{
+			name:        "output-dir",
+			walker:      &path.Walker{Recursive: true, OutputDir: filepath.Join(dir, "sub", "deeper")},
+			root:        dir,
+			expectedRes: []string{"a.yml", "b.yml", "sub/c.yml"},
+		},
+		{
+			name:        "nonexistent-output-dir",
+			walker:      &path.Walker{Recursive: true, OutputDir: filepath.Join(dir, "missing")},
+			root:        dir,
+			expectedRes: []string{"a.yml", "b.yml", "sub/c.yml", "sub/deeper/d.yml"},
+		},
+		{
+			name:        "nonexistent-root",
+			walker:      &path.Walker{},
+			root:        filepath.Join(dir, "missing"),
+			expectedErr: true,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			files, err := c.walker.Files(c.root)
+			assert.Equal(c.expectedErr, err != nil)
+			var rel []string
+			for _, f := range files {
+				r, err := filepath.Rel(dir, f)
+				assert.Nil(err)
+				rel = append(rel, filepath.ToSlash(r))
+			}
+			assert.Equal(c.expectedRes, rel)
+		})
+	}
+}
+
+func TestWalkerFilters(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	dir := t.TempDir()
+	for f, content := range map[string]string{
+		"app.yml":                 "a",
+		"app.yml.tpl":             "a",
+		"logo.png":                "\x89PNG\r\n\x1a\n\x00\x00",
+		"notes.txt":               "a",
+		".gitignore":              "*.txt\nbuild/\n!keep.txt\n",
+		".vaultsubstignore":       "/secret.yml\n",
+		"secret.yml":              "a",
+		"keep.txt":                "a",
+		".git/config":             "a",
+		"build/out.yml":           "a",
+		"vendor/lib/lib.yml":      "a",
+		"sub/.gitignore":          "local.yml\n",
+		"sub/local.yml":           "a",
+		"sub/secret.yml":          "a",
+		"sub/deeper/app.yml.tpl":  "a",
+		"sub/.vaultsubstignore":   "deeper/**/*.tpl\n",
+		"other/.vaultsubstignore": "*\n!*.tpl\n",
+		"other/app.yml":           "a",
+		"other/app.yml.tpl":       "a",
+	} {
+		assert.Nil(os.MkdirAll(filepath.Join(dir, filepath.Dir(f)), 0o755))
+		assert.Nil(os.WriteFile(filepath.Join(dir, f), []byte(content), 0o600))
+	}
+
+	for _, c := range []struct {
+		name            string
+		walker          *path.Walker
+		expectedRes     []string
+		expectedSkipped map[string]string
+	}{
+		{
+			name:   "ignore-file-and-binaries",
+			walker: &path.Walker{Recursive: true},
+			expectedRes: []string{
+				".git/config", ".gitignore", "app.yml", "app.yml.tpl", "build/out.yml", "keep.txt", "notes.txt",
+				"other/app.yml.tpl", "sub/.gitignore", "sub/local.yml", "sub/secret.yml", "vendor/lib/lib.yml",
+			},
+			expectedSkipped: map[string]string{
+				".vaultsubstignore":       "ignore file",
+				"logo.png":                "binary file",
+				"other/.vaultsubstignore": "ignore file",
+				"other/app.yml":           "ignored by .vaultsubstignore",
+				"secret.yml":              "ignored by .vaultsubstignore",
+				"sub/.vaultsubstignore":   "ignore file",
+				"sub/deeper/app.yml.tpl":  "ignored by .vaultsubstignore",
+			},
+		},
+		{
+			name:   "gitignore",
+			walker: &path.Walker{Recursive: true, GitIgnore: true},
+			expectedRes: []string{
+				".gitignore", "app.yml", "app.yml.tpl", "keep.txt", "other/app.yml.tpl", "sub/.gitignore",
+				"sub/secret.yml", "vendor/lib/lib.yml",
+			},
+			expectedSkipped: map[string]string{
+				".git":                    "git directory",
+				".vaultsubstignore":       "ignore file",
+				"build":                   "ignored by .gitignore",
+				"logo.png":                "binary file",
+				"notes.txt":               "ignored by .gitignore",
+				"other/.vaultsubstignore": "ignore file",
+				"other/app.yml":           "ignored by .vaultsubstignore",
+				"secret.yml":              "ignored by .vaultsubstignore",
+				"sub/.vaultsubstignore":   "ignore file",
+				"sub/deeper/app.yml.tpl":  "ignored by .vaultsubstignore",
+				"sub/local.yml":           "ignored by .gitignore",
+			},
+		},
+		{
+			name:        "include-and-exclude",
+			walker:      &path.Walker{Recursive: true, GitIgnore: true, Include: []string{"*.yml", "*.tpl"}, Exclude: []string{"vendor/", "/app.yml"}},
+			expectedRes: []string{"app.yml.tpl", "other/app.yml.tpl", "sub/secret.yml"},
+			expectedSkipped: map[string]string{
+				".git":                    "git directory",
+				".gitignore":              "not included",
+				".vaultsubstignore":       "ignore file",
+				"app.yml":                 "excluded",
+				"build":                   "ignored by .gitignore",
+				"keep.txt":                "not included",
+				"logo.png":                "not included",
+				"notes.txt":               "ignored by .gitignore",
+				"other/.vaultsubstignore": "ignore file",
+				"other/app.yml":           "ignored by .vaultsubstignore",
+				"secret.yml":              "ignored by .vaultsubstignore",
+				"sub/.gitignore":          "not included",
+				"sub/.vaultsubstignore":   "ignore file",
+				"sub/deeper/app.yml.tpl":  "ignored by .vaultsubstignore",
+				"sub/local.yml":           "ignored by .gitignore",
+				"vendor":                  "excluded",
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			skipped := make(map[string]string)
+			c.walker.Skipped = func(p, reason string) {
+				r, err := filepath.Rel(dir, p)
+				assert.Nil(err)
+				skipped[filepath.ToSlash(r)] = reason
+			}
+			files, err := c.walker.Files(dir)
+			assert.Nil(err)
+			var rel []string
+			for _, f := range files {
+				r, err := filepath.Rel(dir, f)
+				assert.Nil(err)
+				rel = append(rel, filepath.ToSlash(r))
+			}
+			assert.Equal(c.expectedRes, rel)
+			assert.Equal(c.expectedSkipped, skipped)
+		})
+	}
+}
+
+func TestWalkerSymlinks(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	// Resolve the temporary directory itself, such that the targets reported
+	// in skip reasons are predictable.
+	base, err := filepath.EvalSymlinks(t.TempDir())
+	assert.Nil(err)
+	dir := filepath.Join(base, "root")
+	outside := filepath.Join(base, "outside")
+	for _, f := range []string{"root/a.yml", "root/sub/b.yml", "root/z/e.yml", "outside/c.yml"} {
+		assert.Nil(os.MkdirAll(filepath.Join(base, filepath.Dir(f)), 0o755))
+		assert.Nil(os.WriteFile(filepath.Join(base, f), nil, 0o600))
+	}
+	for link, target := range map[string]string{
+		"root/link.yml":         "a.yml",
+		"root/outside.yml":      "../outside/c.yml",
+		"root/outside-dir":      outside,
+		"root/sub/loop":         "..",
+		"root/sub-link":         "sub",
+		"root/a-link":           "z", // sorts before its own target
+		"root/broken.yml":       "missing.yml",
+		"root/sub/nested/d.yml": "../b.yml",
+	} {
+		assert.Nil(os.MkdirAll(filepath.Join(base, filepath.Dir(link)), 0o755))
+		assert.Nil(os.Symlink(target, filepath.Join(base, link)))
+	}
+
+	for _, c := range []struct {
+		name            string
+		walker          *path.Walker
+		expectedRes     []string
+		expectedSkipped map[string]string
+	}{
+		{
+			name:        "not-followed",
+			walker:      &path.Walker{Recursive: true},
+			expectedRes: []string{"a.yml", "link.yml", "outside.yml", "sub/b.yml", "sub/nested/d.yml", "z/e.yml"},
+			expectedSkipped: map[string]string{
+				"a-link":      "symlink to directory",
+				"broken.yml":  "broken symlink",
+				"outside-dir": "symlink to directory",
+				"sub-link":    "symlink to directory",
+				"sub/loop":    "symlink to directory",
+			},
+		},
+		{
+			name:   "followed",
+			walker: &path.Walker{Recursive: true, FollowSymlinks: true},
+			expectedRes: []string{
+				"a.yml", "link.yml", "outside-dir/c.yml", "outside.yml", "sub/b.yml", "sub/nested/d.yml", "z/e.yml",
+			},
+			expectedSkipped: map[string]string{
+				"a-link":     "symlink to directory below the root directory",
+				"broken.yml": "broken symlink",
+				"sub-link":   "symlink loop or directory already visited",
+				"sub/loop":   "symlink loop or directory already visited",
+			},
+		},
+		{
+			name:        "followed-confined",
+			walker:      &path.Walker{Recursive: true, FollowSymlinks: true, Confined: true},
+			expectedRes: []string{"a.yml", "link.yml", "sub/b.yml", "sub/nested/d.yml", "z/e.yml"},
+			expectedSkipped: map[string]string{
+				"a-link":      "symlink to directory below the root directory",
+				"broken.yml":  "broken symlink",
+				"outside-dir": "symlink target " + outside + " is outside of the root directory",
+				"outside.yml": "symlink target " + filepath.Join(outside, "c.yml") + " is outside of the root directory",
+				"sub-link":    "symlink loop or directory already visited",
+				"sub/loop":    "symlink loop or directory already visited",
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			skipped := make(map[string]string)
+			c.walker.Skipped = func(p, reason string) {
+				r, err := filepath.Rel(dir, p)
+				assert.Nil(err)
+				skipped[filepath.ToSlash(r)] = reason
+			}
+			files, err := c.walker.Files(dir)
+			assert.Nil(err)
+			var rel []string
+			for _, f := range files {
+				r, err := filepath.Rel(dir, f)
+				assert.Nil(err)
+				rel = append(rel, filepath.ToSlash(r))
+			}
+			assert.Equal(c.expectedRes, rel)
+			assert.Equal(c.expectedSkipped, skipped)
+		})
+	}
+}
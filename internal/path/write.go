@@ -0,0 +1,68 @@
+package path
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes data to name by writing it to a temporary file in the
+// same directory first, which then replaces name. As such, name is never left
+// partially written. If name is a symlink, its target is replaced instead.
+//
+// If mode is zero, the mode of an existing file is preserved and new files are
+// created with mode 0644. Otherwise, mode is set on the file regardless. The
+// owner of an existing file is preserved if permitted.
+func WriteFileAtomic(name string, data []byte, mode fs.FileMode) error {
+	target, err := filepath.EvalSymlinks(name)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		target = name
+	case err != nil:
+		return err
+	}
+
+	perm := mode
+	fi, err := os.Stat(target)
+	switch {
+	case err == nil && perm == 0:
+		perm = fi.Mode().Perm()
+	case errors.Is(err, fs.ErrNotExist):
+		fi = nil
+		if perm == 0 {
+			perm = 0o644
+		}
+	case err != nil:
+		return err
+	}
+
+	f, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	defer f.Close()
+
+	if _, err := f.Write(data); err != nil {
+		return err
+	}
+	// Temporary files are created with mode 0600, set the final mode before the
+	// file becomes visible under its name.
+	if err := f.Chmod(perm); err != nil {
+		return err
+	}
+	if fi != nil {
+		if err := chown(f, fi); err != nil {
+			return err
+		}
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, target)
+}
@@ -0,0 +1,89 @@
+package path_test
+
+import (
+	"io/fs"
+	"os"
+	gopath "path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/path"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	for _, c := range []struct {
+		name string
+		// existing is the mode of the file prior to writing, zero if it does not
+		// exist.
+		existing     fs.FileMode
+		mode         fs.FileMode
+		symlink      bool
+		expectedMode fs.FileMode
+	}{
+		{
+			name:         "new-file",
+			expectedMode: 0o644,
+		},
+		{
+			name:         "new-file-with-mode",
+			mode:         0o600,
+			expectedMode: 0o600,
+		},
+		{
+			name:         "mode-preserved",
+			existing:     0o640,
+			expectedMode: 0o640,
+		},
+		{
+			name:         "mode-forced",
+			existing:     0o644,
+			mode:         0o600,
+			expectedMode: 0o600,
+		},
+		{
+			name:         "symlink-target-replaced",
+			existing:     0o640,
+			symlink:      true,
+			expectedMode: 0o640,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			file := gopath.Join(dir, "file")
+			if c.existing != 0 {
+				assert.Nil(os.WriteFile(file, []byte("old contents"), c.existing), "failed to prepare env")
+				assert.Nil(os.Chmod(file, c.existing), "failed to prepare env")
+			}
+			name := file
+			if c.symlink {
+				name = gopath.Join(dir, "link")
+				assert.Nil(os.Symlink("file", name), "failed to prepare env")
+			}
+
+			assert.Nil(path.WriteFileAtomic(name, []byte("new contents"), c.mode))
+
+			b, err := os.ReadFile(file)
+			assert.Nil(err)
+			assert.Equal("new contents", string(b))
+			fi, err := os.Stat(file)
+			assert.Nil(err)
+			assert.Equal(c.expectedMode, fi.Mode().Perm())
+			if c.symlink {
+				fi, err := os.Lstat(name)
+				assert.Nil(err)
+				assert.Equal(fs.ModeSymlink, fi.Mode().Type())
+			}
+			// No temporary files are left behind.
+			expectedEntries := 1
+			if c.symlink {
+				expectedEntries = 2
+			}
+			entries, err := os.ReadDir(dir)
+			assert.Nil(err)
+			assert.Len(entries, expectedEntries)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package policy
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Policy is a vault ACL policy granting capabilities on a set of paths.
+type Policy struct {
+	// Namespace is the namespace the policy is written to. Paths in namespaces
+	// below it are prefixed with their namespace relative to it.
+	Namespace string
+
+	paths map[string][]string
+}
+
+// Add grants caps on path in namespace ns. Capabilities granted on the same
+// path are merged.
+func (p *Policy) Add(ns, path string, caps ...string) error {
+	path, err := p.relative(ns, path)
+	if err != nil {
+		return err
+	}
+	if p.paths == nil {
+		p.paths = make(map[string][]string)
+	}
+	for _, c := range caps {
+		if !slices.Contains(p.paths[path], c) {
+			p.paths[path] = append(p.paths[path], c)
+		}
+	}
+	return nil
+}
+
+// relative returns path prefixed with ns relative to the policy's namespace.
+func (p *Policy) relative(ns, path string) (string, error) {
+	base := strings.Trim(p.Namespace, "/")
+	ns = strings.Trim(ns, "/")
+	if ns == base {
+		return path, nil
+	}
+	if base == "" {
+		return ns + "/" + path, nil
+	}
+	rel, ok := strings.CutPrefix(ns, base+"/")
+	if !ok {
+		return "", fmt.Errorf("namespace %s is not below namespace %s", ns, base)
+	}
+	return rel + "/" + path, nil
+}
+
+// covered reports whether path is matched by another glob path of the policy
+// granting at least the same capabilities.
+func (p *Policy) covered(path string) bool {
+	for glob, caps := range p.paths {
+		prefix, ok := strings.CutSuffix(glob, "*")
+		if !ok || glob == path || !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		if !slices.ContainsFunc(p.paths[path], func(c string) bool { return !slices.Contains(caps, c) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteHCL writes the policy in HCL, with paths in lexical order. Paths which
+// are covered by a glob path granting the same capabilities are omitted.
+func (p *Policy) WriteHCL(w io.Writer) error {
+	paths := make([]string, 0, len(p.paths))
+	for path := range p.paths {
+		if !p.covered(path) {
+			paths = append(paths, path)
+		}
+	}
+	slices.Sort(paths)
+	for i, path := range paths {
+		if i > 0 {
+			if _, err := io.WriteString(w, "\n"); err != nil {
+				return err
+			}
+		}
+		caps := make([]string, len(p.paths[path]))
+		for j, c := range p.paths[path] {
+			caps[j] = fmt.Sprintf("%q", c)
+		}
+		if _, err := fmt.Fprintf(w, "path %q {\n  capabilities = [%s]\n}\n", path, strings.Join(caps, ", ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Generalize replaces all segments of path beyond the first depth segments
+// with a glob. Paths with at most depth segments, as well as all paths if
+// depth is zero or less, are returned unchanged.
+func Generalize(path string, depth int) string {
+	segments := strings.Split(path, "/")
+	if depth <= 0 || len(segments) <= depth {
+		return path
+	}
+	return strings.Join(segments[:depth], "/") + "/*"
+}
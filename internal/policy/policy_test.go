@@ -0,0 +1,122 @@
+package policy_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/policy"
+)
+
+func TestPolicy(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	type grant struct{ ns, path string }
+	for _, c := range []struct {
+		name        string
+		namespace   string
+		grants      []grant
+		expected    string
+		expectedErr error
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:   "sorted-and-merged",
+			grants: []grant{{"", "kv/data/b"}, {"", "kv1/a"}, {"", "kv/data/b"}, {"", "kv/data/a"}},
+			expected: `path "kv/data/a" {
+  capabilities = ["read"]
+}
+
+path "kv/data/b" {
+  capabilities = ["read"]
+}
+
+path "kv1/a" {
+  capabilities = ["read"]
+}
+`,
+		},
+		{
+			name:      "child-namespaces",
+			namespace: "org/",
+			grants:    []grant{{"org", "kv/data/a"}, {"org/team-a", "kv/data/a"}},
+			expected: `path "kv/data/a" {
+  capabilities = ["read"]
+}
+
+path "team-a/kv/data/a" {
+  capabilities = ["read"]
+}
+`,
+		},
+		{
+			name:   "root-namespace",
+			grants: []grant{{"org/team-a", "kv/data/a"}},
+			expected: `path "org/team-a/kv/data/a" {
+  capabilities = ["read"]
+}
+`,
+		},
+		{
+			name: "covered-by-glob",
+			grants: []grant{
+				{"", "kv/data/app/db"}, {"", "kv/data/app/*"}, {"", "kv/data/application"},
+				{"", "kv/data/*"}, {"", "kv/metadata/app/db"},
+			},
+			expected: `path "kv/data/*" {
+  capabilities = ["read"]
+}
+
+path "kv/metadata/app/db" {
+  capabilities = ["read"]
+}
+`,
+		},
+		{
+			name:        "foreign-namespace",
+			namespace:   "org",
+			grants:      []grant{{"other", "kv/data/a"}},
+			expectedErr: errors.New("namespace other is not below namespace org"),
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			p := &policy.Policy{Namespace: c.namespace}
+			var err error
+			for _, g := range c.grants {
+				if err = p.Add(g.ns, g.path, "read"); err != nil {
+					break
+				}
+			}
+			assert.Equal(c.expectedErr, err)
+			if err != nil {
+				return
+			}
+			var b strings.Builder
+			assert.Nil(p.WriteHCL(&b))
+			assert.Equal(c.expected, b.String())
+		})
+	}
+}
+
+func TestGeneralize(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	for _, c := range []struct {
+		path     string
+		depth    int
+		expected string
+	}{
+		{path: "storage/postgres/creds", depth: 0, expected: "storage/postgres/creds"},
+		{path: "storage/postgres/creds", depth: 1, expected: "storage/*"},
+		{path: "storage/postgres/creds", depth: 2, expected: "storage/postgres/*"},
+		{path: "storage/postgres/creds", depth: 3, expected: "storage/postgres/creds"},
+		{path: "app", depth: 1, expected: "app"},
+	} {
+		assert.Equal(c.expected, policy.Generalize(c.path, c.depth), "%s at depth %d", c.path, c.depth)
+	}
+}
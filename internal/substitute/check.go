@@ -0,0 +1,92 @@
+package substitute
+
+import (
+	"io"
+	"regexp"
+
+	"github.com/toalaah/vaultsubst/internal/vault"
+)
+
+// Reference describes a secret reference found in a document.
+type Reference struct {
+	// File is the name of the file containing the reference, if known.
+	File string
+	// Line and Col are the 1-based position of the reference's opening
+	// delimiter, with Col counted in bytes.
+	Line, Col int
+	// Spec is the unparsed spec of the reference.
+	Spec string
+	// Secret is the parsed spec, nil if it could not be parsed.
+	Secret *vault.SecretSpec
+	// Err is the reason the reference could not be substituted, nil if the
+	// reference is valid.
+	Err error
+}
+
+// Find returns the references matched by regexp in r in document order. The
+// spec of each reference is parsed, but not resolved. References whose spec
+// could not be parsed have their Err field set, or are omitted in non-strict
+// mode. Escaped delimiters are omitted as well. An error is only returned if r
+// could not be read.
+func Find(r io.Reader, regexp *regexp.Regexp, opts ...Option) ([]*Reference, error) {
+	o := newOptions(opts)
+	f, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	s := string(f)
+	matches := findMatches(s, regexp, o)
+
+	var refs []*Reference
+	pos := newPosition(s)
+	for _, m := range matches {
+		if isEscape(m) {
+			continue
+		}
+		raw := s[m[2]:m[3]]
+		spec, err := o.parser(raw)
+		line, col := pos.at(m[0])
+		refs = append(refs, &Reference{File: o.filename, Line: line, Col: col, Spec: raw, Secret: spec, Err: err})
+	}
+	return refs, nil
+}
+
+// Check validates each reference matched by regexp in r without substituting
+// it. Each reference is resolved and formatted as PatchSecrets would, but the
+// resulting values are discarded. If client is nil, only the syntax of each
+// spec and the names of its transformations and metadata are checked, without
+// contacting vault. References are returned in document order as by Find.
+func Check(r io.Reader, regexp *regexp.Regexp, client *vault.Client, opts ...Option) ([]*Reference, error) {
+	o := newOptions(opts)
+	refs, err := Find(r, regexp, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check each distinct, parseable spec once.
+	var specs []string
+	indices := make(map[string]int)
+	parsed := make(map[string]*vault.SecretSpec)
+	for _, ref := range refs {
+		if _, ok := indices[ref.Spec]; ok || ref.Err != nil {
+			continue
+		}
+		indices[ref.Spec] = len(specs)
+		specs = append(specs, ref.Spec)
+		parsed[ref.Spec] = ref.Secret
+	}
+
+	_, errs := resolve(specs, o.concurrency, func(raw string) (string, error) {
+		spec := parsed[raw]
+		if client == nil {
+			return "", spec.Validate()
+		}
+		return readSpec(spec, client)
+	})
+	for _, ref := range refs {
+		if ref.Err == nil {
+			ref.Err = errs[indices[ref.Spec]]
+		}
+	}
+	return refs, nil
+}
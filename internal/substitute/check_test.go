@@ -0,0 +1,102 @@
+package substitute_test
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/substitute"
+	"github.com/toalaah/vaultsubst/internal/vault"
+)
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	re := regexp.MustCompile(`@@(.*?)@@`)
+	body := "user: @@path=kv/storage/postgres/creds,field=username,b64=true,transform=trim|upper@@\n" +
+		"pass: @@path=kv/storage/postgres/creds,field=doesnotexist@@\n" +
+		"bad: @@path=kv/storage/postgres/creds,field=username,transform=wrong@@ @@wrong@@\n"
+
+	for _, c := range []struct {
+		name     string
+		client   *vault.Client
+		expected []*substitute.Reference
+	}{
+		{
+			name:   "online",
+			client: newMockClient(),
+			expected: []*substitute.Reference{
+				{File: "app.yml", Line: 1, Col: 7, Spec: "path=kv/storage/postgres/creds,field=username,b64=true,transform=trim|upper"},
+				{File: "app.yml", Line: 2, Col: 7, Spec: "path=kv/storage/postgres/creds,field=doesnotexist", Err: errors.New("could not cast data at field doesnotexist to string")},
+				{File: "app.yml", Line: 3, Col: 6, Spec: "path=kv/storage/postgres/creds,field=username,transform=wrong", Err: errors.New("unknown transformation: wrong")},
+				{File: "app.yml", Line: 3, Col: 72, Spec: "wrong", Err: errors.New("unable to parse option: wrong (value wrong)")},
+			},
+		},
+		{
+			name: "offline",
+			expected: []*substitute.Reference{
+				{File: "app.yml", Line: 1, Col: 7, Spec: "path=kv/storage/postgres/creds,field=username,b64=true,transform=trim|upper"},
+				{File: "app.yml", Line: 2, Col: 7, Spec: "path=kv/storage/postgres/creds,field=doesnotexist"},
+				{File: "app.yml", Line: 3, Col: 6, Spec: "path=kv/storage/postgres/creds,field=username,transform=wrong", Err: errors.New("unknown transformation: wrong")},
+				{File: "app.yml", Line: 3, Col: 72, Spec: "wrong", Err: errors.New("unable to parse option: wrong (value wrong)")},
+			},
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			refs, err := substitute.Check(strings.NewReader(body), re, c.client, substitute.WithFilename("app.yml"))
+			assert.Nil(err)
+			// Parsed specs are covered by TestFind.
+			for _, ref := range refs {
+				ref.Secret = nil
+			}
+			assert.Equal(c.expected, refs)
+		})
+	}
+}
+
+func TestFind(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	re := regexp.MustCompile(`@@(.*?)@@`)
+	body := "user: @@path=kv/storage/postgres/creds,field=username,transform=trim|upper@@\n" +
+		"owner: @@path=kv/storage/postgres/creds,meta=custom.owner,ns=team-a@@ @@wrong@@\n"
+
+	refs, err := substitute.Find(strings.NewReader(body), re)
+	assert.Nil(err)
+	assert.Equal([]*substitute.Reference{
+		{
+			Line: 1, Col: 7, Spec: "path=kv/storage/postgres/creds,field=username,transform=trim|upper",
+			Secret: &vault.SecretSpec{Path: "kv/storage/postgres/creds", Field: "username", Transformations: []string{"trim", "upper"}},
+		},
+		{
+			Line: 2, Col: 8, Spec: "path=kv/storage/postgres/creds,meta=custom.owner,ns=team-a",
+			Secret: &vault.SecretSpec{Path: "kv/storage/postgres/creds", Meta: "custom.owner", Namespace: "team-a"},
+		},
+		{Line: 2, Col: 71, Spec: "wrong", Err: errors.New("unable to parse option: wrong (value wrong)")},
+	}, refs)
+
+	_, err = substitute.Find(&errReader{}, re)
+	assert.Equal(errors.New("read error"), err)
+}
+
+func TestFindEscapes(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	re, err := substitute.NewRegexp("@@", "@@")
+	assert.Nil(err)
+	body := `\@@ escaped \@@ @@path=kv/storage/postgres/creds,field=username@@ @@ -1 +1 @@`
+
+	refs, err := substitute.Find(strings.NewReader(body), re)
+	assert.Nil(err)
+	assert.Len(refs, 2)
+	assert.Equal(17, refs[0].Col)
+	assert.Equal(" -1 +1 ", refs[1].Spec)
+	assert.NotNil(refs[1].Err)
+
+	refs, err = substitute.Find(strings.NewReader(body), re, substitute.WithStrict(false))
+	assert.Nil(err)
+	assert.Len(refs, 1)
+	assert.Equal("path=kv/storage/postgres/creds,field=username", refs[0].Spec)
+}
@@ -0,0 +1,71 @@
+package substitute
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Error describes a failure to substitute a single secret reference.
+type Error struct {
+	// File is the name of the file containing the reference, if known.
+	File string
+	// Line and Col are the 1-based position of the reference's opening
+	// delimiter, with Col counted in bytes.
+	Line, Col int
+	// Spec is the unparsed spec of the reference.
+	Spec string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("%d:%d: %s", e.Line, e.Col, e.Err)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Col, e.Err)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// Errors is a list of substitution errors, ordered by their position.
+type Errors []*Error
+
+func (e Errors) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+func (e Errors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// position converts byte offsets in a document into line and column numbers.
+// Offsets must be passed in ascending order.
+type position struct {
+	s         string
+	offset    int
+	line      int
+	lineStart int
+}
+
+func newPosition(s string) *position {
+	return &position{s: s, line: 1}
+}
+
+// at returns the 1-based line and byte column of offset.
+func (p *position) at(offset int) (int, int) {
+	for i := p.offset; i < offset; i++ {
+		if p.s[i] == '\n' {
+			p.line++
+			p.lineStart = i + 1
+		}
+	}
+	p.offset = offset
+	return p.line, offset - p.lineStart + 1
+}
@@ -0,0 +1,67 @@
+package substitute
+
+import "github.com/toalaah/vaultsubst/internal/vault"
+
+// Option configures the behavior of PatchSecrets.
+type Option func(*options)
+
+type options struct {
+	concurrency int
+	filename    string
+	redactor    Redactor
+	parser      Parser
+	strict      bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{concurrency: 1, parser: vault.NewSecretSpec, strict: true}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// WithConcurrency sets the maximum number of secrets resolved concurrently.
+// Values below one are ignored, defaults to one.
+func WithConcurrency(n int) Option {
+	return func(o *options) {
+		if n > 0 {
+			o.concurrency = n
+		}
+	}
+}
+
+// WithFilename sets the file name reported in errors.
+func WithFilename(name string) Option {
+	return func(o *options) {
+		o.filename = name
+	}
+}
+
+// WithRedactor sets a redactor which replaces each resolved secret before it
+// is substituted. Secrets are still read and formatted as usual.
+func WithRedactor(r Redactor) Option {
+	return func(o *options) {
+		o.redactor = r
+	}
+}
+
+// Parser parses the spec captured from a reference.
+type Parser func(raw string) (*vault.SecretSpec, error)
+
+// WithParser sets the parser used for specs, defaults to vault.NewSecretSpec.
+func WithParser(p Parser) Option {
+	return func(o *options) {
+		if p != nil {
+			o.parser = p
+		}
+	}
+}
+
+// WithStrict sets whether matches whose spec cannot be parsed are reported as
+// errors, defaults to true. Otherwise, such matches are left untouched.
+func WithStrict(strict bool) Option {
+	return func(o *options) {
+		o.strict = strict
+	}
+}
@@ -4,32 +4,124 @@ import (
 	"io"
 	"regexp"
 	"strings"
+	"sync"
 
 	"github.com/toalaah/vaultsubst/internal/vault"
 )
 
-func PatchSecrets(r io.Reader, regexp *regexp.Regexp, client *vault.Client) ([]byte, error) {
+// PatchSecrets replaces each match of regexp in r with the secret described by
+// the match's first capture group. Matches without the capture group are
+// escaped delimiters, which are replaced by the delimiter without its leading
+// backslash. Distinct secrets are resolved concurrently as configured by opts,
+// with the substitution performed in a single pass afterwards. If any secrets
+// fail to resolve, an Errors value containing an error for each failing
+// reference in document order is returned.
+//
+// In non-strict mode, text between delimiters which cannot be parsed as a spec
+// is not considered a reference and left untouched.
+func PatchSecrets(r io.Reader, regexp *regexp.Regexp, client *vault.Client, opts ...Option) ([]byte, error) {
+	o := newOptions(opts)
 	f, err := io.ReadAll(r)
 	if err != nil {
 		return nil, err
 	}
 	s := string(f)
-	matches := regexp.FindAllStringSubmatch(s, -1)
-	for _, match := range matches {
-		originalContent := match[0]
-		spec, err := vault.NewSecretSpec(match[1])
-		if err != nil {
-			return nil, err
+	matches := findMatches(s, regexp, o)
+
+	specs, indices := distinctSpecs(s, matches)
+
+	values, errs := resolve(specs, o.concurrency, func(raw string) (string, error) {
+		return resolveSpec(raw, client, o)
+	})
+	var patchErrs Errors
+	pos := newPosition(s)
+	for _, m := range matches {
+		if isEscape(m) {
+			continue
 		}
-		res, err := client.ReadKV(spec)
-		if err != nil {
-			return nil, err
+		raw := s[m[2]:m[3]]
+		if err := errs[indices[raw]]; err != nil {
+			line, col := pos.at(m[0])
+			patchErrs = append(patchErrs, &Error{File: o.filename, Line: line, Col: col, Spec: raw, Err: err})
 		}
-		secret, err := spec.FormatSecret(res)
-		if err != nil {
-			return nil, err
+	}
+	if len(patchErrs) > 0 {
+		return nil, patchErrs
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(s[last:m[0]])
+		last = m[1]
+		if isEscape(m) {
+			b.WriteString(s[m[0]+1 : m[1]])
+			continue
 		}
-		s = strings.ReplaceAll(s, originalContent, secret)
+		b.WriteString(values[indices[s[m[2]:m[3]]]])
+	}
+	b.WriteString(s[last:])
+	return []byte(b.String()), nil
+}
+
+// distinctSpecs returns the distinct specs captured by matches in document
+// order, such that each one is only resolved once. The returned map holds the
+// index of each spec.
+func distinctSpecs(s string, matches [][]int) ([]string, map[string]int) {
+	var specs []string
+	indices := make(map[string]int)
+	for _, m := range matches {
+		if isEscape(m) {
+			continue
+		}
+		raw := s[m[2]:m[3]]
+		if _, ok := indices[raw]; !ok {
+			indices[raw] = len(specs)
+			specs = append(specs, raw)
+		}
+	}
+	return specs, indices
+}
+
+// resolve calls fn for each of specs using at most n concurrent workers. The
+// returned values and errors are in the same order as specs.
+func resolve(specs []string, n int, fn func(string) (string, error)) ([]string, []error) {
+	values := make([]string, len(specs))
+	errs := make([]error, len(specs))
+	sem := make(chan struct{}, n)
+	var wg sync.WaitGroup
+	for i, raw := range specs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			values[i], errs[i] = fn(raw)
+		}()
+	}
+	wg.Wait()
+	return values, errs
+}
+
+// resolveSpec parses raw and returns the formatted secret it describes,
+// replaced by the configured redactor if any.
+func resolveSpec(raw string, client *vault.Client, o *options) (string, error) {
+	spec, err := o.parser(raw)
+	if err != nil {
+		return "", err
+	}
+	v, err := readSpec(spec, client)
+	if err != nil || o.redactor == nil {
+		return v, err
+	}
+	return o.redactor(spec, v), nil
+}
+
+// readSpec reads the secret described by spec and formats it accordingly.
+func readSpec(spec *vault.SecretSpec, client *vault.Client) (string, error) {
+	res, err := client.ReadKV(spec)
+	if err != nil {
+		return "", err
 	}
-	return []byte(s), nil
+	return spec.FormatSecret(res)
 }
@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/stretchr/testify/assert"
@@ -46,19 +47,34 @@ This value should not be substituted due to a different delimiter:  "$$path=kv/s
 			expectedRes: "username=POSTGRES,password=4_5tr0ng_4nd_c0mpl1c4t3d_p455w0rd",
 		},
 		{
-			name:        "invalid-spec-unknown-field",
-			expectedErr: errors.New("unable to parse option: incorrect-spec (value incorrect-spec)"),
-			body:        "Some text here @@incorrect-spec@@",
+			name: "invalid-spec-unknown-field",
+			expectedErr: substitute.Errors{
+				{Line: 1, Col: 16, Spec: "incorrect-spec", Err: errors.New("unable to parse option: incorrect-spec (value incorrect-spec)")},
+			},
+			body: "Some text here @@incorrect-spec@@",
 		},
 		{
-			name:        "invalid-spec-invalid-path",
-			expectedErr: errors.New("no path to query using mountpoint kv"),
-			body:        "Some text here @@path=kv/,field=something@@",
+			name: "invalid-spec-invalid-path",
+			expectedErr: substitute.Errors{
+				{Line: 1, Col: 16, Spec: "path=kv/,field=something", Err: errors.New("no path to query using mountpoint kv")},
+			},
+			body: "Some text here @@path=kv/,field=something@@",
 		},
 		{
-			name:        "invalid-spec-format-errors",
-			expectedErr: errors.New("unknown transformation: wrong"),
-			body:        "Some text here @@path=kv/storage/postgres/creds,field=username,transform=wrong@@",
+			name: "invalid-spec-format-errors",
+			expectedErr: substitute.Errors{
+				{Line: 1, Col: 16, Spec: "path=kv/storage/postgres/creds,field=username,transform=wrong", Err: errors.New("unknown transformation: wrong")},
+			},
+			body: "Some text here @@path=kv/storage/postgres/creds,field=username,transform=wrong@@",
+		},
+		{
+			name: "multiple-errors",
+			expectedErr: substitute.Errors{
+				{Line: 2, Col: 7, Spec: "wrong", Err: errors.New("unable to parse option: wrong (value wrong)")},
+				{Line: 3, Col: 1, Spec: "path=kv/,field=something", Err: errors.New("no path to query using mountpoint kv")},
+				{Line: 3, Col: 34, Spec: "wrong", Err: errors.New("unable to parse option: wrong (value wrong)")},
+			},
+			body: "valid: @@path=kv/storage/postgres/creds,field=password@@\nfirst @@wrong@@\n@@path=kv/,field=something@@ and @@wrong@@ again",
 		},
 	} {
 		t.Run(c.name, func(t *testing.T) {
@@ -69,6 +85,117 @@ This value should not be substituted due to a different delimiter:  "$$path=kv/s
 	}
 }
 
+func TestSecretPatchingConcurrent(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	m := &mockKVReader{}
+	for i := range 20 {
+		m.On("ReadKVv2", "kv", fmt.Sprintf("app/%d", i)).Return(&api.KVSecret{
+			Data: map[string]any{"value": fmt.Sprint(i)},
+		}, nil).Once()
+	}
+	// The first failing secret in the document responds slowest, it must still
+	// be the one reported.
+	m.
+		On("ReadKVv2", "kv", "slow/failure").After(50*time.Millisecond).Return((*api.KVSecret)(nil), errors.New("slow failure")).
+		On("ReadKVv2", "kv", "fast/failure").Return((*api.KVSecret)(nil), errors.New("fast failure"))
+	client := &vault.Client{KVReader: m}
+	re := regexp.MustCompile(`@@(.*?)@@`)
+
+	var body, expected strings.Builder
+	for i := range 20 {
+		// Reference each secret twice, it should only be read once.
+		fmt.Fprintf(&body, "%[1]d=@@path=kv/app/%[1]d,field=value@@,@@path=kv/app/%[1]d,field=value@@\n", i)
+		fmt.Fprintf(&expected, "%[1]d=%[1]d,%[1]d\n", i)
+	}
+	b, err := substitute.PatchSecrets(strings.NewReader(body.String()), re, client, substitute.WithConcurrency(8))
+	assert.Nil(err)
+	assert.Equal(expected.String(), string(b))
+
+	b, err = substitute.PatchSecrets(strings.NewReader("@@path=kv/slow/failure,field=value@@ @@path=kv/fast/failure,field=value@@"), re, client, substitute.WithConcurrency(8), substitute.WithFilename("app.yml"))
+	assert.Equal(substitute.Errors{
+		{File: "app.yml", Line: 1, Col: 1, Spec: "path=kv/slow/failure,field=value", Err: errors.New("slow failure")},
+		{File: "app.yml", Line: 1, Col: 38, Spec: "path=kv/fast/failure,field=value", Err: errors.New("fast failure")},
+	}, err)
+	assert.Equal("app.yml:1:1: slow failure\napp.yml:1:38: fast failure", err.Error())
+	assert.Nil(b)
+}
+
+func TestSecretPatchingEnvsubst(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	client := newMockClient()
+	re, err := substitute.NewRegexp(substitute.EnvsubstOpen, substitute.EnvsubstClose)
+	assert.Nil(err)
+
+	b, err := substitute.PatchSecrets(
+		strings.NewReader("DB_USER=${vault:kv/storage/postgres/creds#username|base64d|upper} DB_PASS=${vault:kv/storage/postgres/creds#password}\nHOME=${HOME}\n"),
+		re, client, substitute.WithParser(vault.ParseEnvsubstSpec),
+	)
+	assert.Nil(err)
+	assert.Equal("DB_USER=POSTGRES DB_PASS=4_5tr0ng_4nd_c0mpl1c4t3d_p455w0rd\nHOME=${HOME}\n", string(b))
+
+	_, err = substitute.PatchSecrets(strings.NewReader("${vault:kv/storage/postgres/creds}"), re, client, substitute.WithParser(vault.ParseEnvsubstSpec))
+	assert.EqualError(err, "1:1: unable to parse spec: kv/storage/postgres/creds (expected path#field)")
+}
+
+func TestSecretPatchingEscapes(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	client := newMockClient()
+	re, err := substitute.NewRegexp("@@", "@@")
+	assert.Nil(err)
+
+	for _, c := range []struct {
+		name        string
+		strict      bool
+		body        string
+		expectedRes string
+		expectedErr string
+	}{
+		{
+			name:        "escaped-delimiters",
+			strict:      true,
+			body:        "\\@@ -1,3 +1,3 \\@@ user=@@path=kv/storage/postgres/creds,field=username,b64=true@@ \\@@",
+			expectedRes: "@@ -1,3 +1,3 @@ user=postgres @@",
+		},
+		{
+			name:        "strict",
+			strict:      true,
+			body:        "@@ -1,3 +1,3 @@ user=@@path=kv/storage/postgres/creds,field=username,b64=true@@",
+			expectedErr: "1:1: unable to parse option: -1,3+1,3 (value -1)",
+		},
+		{
+			name:        "non-strict",
+			body:        "@@ -1,3 +1,3 @@ user=@@path=kv/storage/postgres/creds,field=username,b64=true@@",
+			expectedRes: "@@ -1,3 +1,3 @@ user=postgres",
+		},
+		{
+			// The closing delimiter of a stray one may open a reference.
+			name:        "non-strict-odd-delimiters",
+			body:        "decorator @@foo user=@@path=kv/storage/postgres/creds,field=username,b64=true@@",
+			expectedRes: "decorator @@foo user=postgres",
+		},
+		{
+			// Specs which can be parsed are still resolved in non-strict mode.
+			name:        "non-strict-resolve-errors",
+			body:        "@@ -1 +1 @@ @@path=kv/,field=something@@",
+			expectedErr: "1:13: no path to query using mountpoint kv",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b, err := substitute.PatchSecrets(strings.NewReader(c.body), re, client, substitute.WithStrict(c.strict))
+			if c.expectedErr != "" {
+				assert.EqualError(err, c.expectedErr)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(c.expectedRes, string(b))
+		})
+	}
+}
+
 func TestSecretPatchingWithReaderError(t *testing.T) {
 	assert := assert.New(t)
 	client := newMockClient()
@@ -97,6 +224,12 @@ func (m *mockKVReader) ReadKVv2(mount, path string) (*api.KVSecret, error) {
 	return args.Get(0).(*api.KVSecret), args.Error(1)
 }
 
+func (m *mockKVReader) ReadKVv2Version(mount, path string, version int) (*api.KVSecret, error) {
+	args := m.Called(mount, path, version)
+	//nolint:forcetypeassert,errcheck // for testing purposes this is fine.
+	return args.Get(0).(*api.KVSecret), args.Error(1)
+}
+
 func newMockClient() *vault.Client {
 	m := &mockKVReader{}
 	m.On("ReadKVv2", "kv", "storage/postgres/creds").Return(&api.KVSecret{
@@ -0,0 +1,34 @@
+package substitute
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"github.com/toalaah/vaultsubst/internal/vault"
+)
+
+// Redactor returns the replacement for value, the formatted secret described
+// by spec.
+type Redactor func(spec *vault.SecretSpec, value string) string
+
+// RedactPlaceholder replaces value with a placeholder naming the secret, such
+// as "<redacted:kv/storage/postgres/creds#password>".
+func RedactPlaceholder(spec *vault.SecretSpec, value string) string {
+	return "<redacted:" + spec.String() + ">"
+}
+
+// RedactMask replaces each character of value with an asterisk, preserving its
+// length in characters. Line breaks are preserved as well such that the
+// layout of multi-line secrets is retained.
+func RedactMask(spec *vault.SecretSpec, value string) string {
+	var b strings.Builder
+	b.Grow(utf8.RuneCountInString(value))
+	for _, r := range value {
+		if r == '\n' {
+			b.WriteRune(r)
+			continue
+		}
+		b.WriteByte('*')
+	}
+	return b.String()
+}
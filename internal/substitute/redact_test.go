@@ -0,0 +1,65 @@
+package substitute_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/substitute"
+)
+
+func TestSecretPatchingRedacted(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	client := newMockClient()
+	re := regexp.MustCompile(`@@(.*?)@@`)
+	body := "user: @@path=kv/storage/postgres/creds,field=username,b64=true,transform=trim|upper@@\n" +
+		"pass: @@path=kv/storage/postgres/creds,field=password@@\n"
+
+	for _, c := range []struct {
+		name        string
+		redactor    substitute.Redactor
+		body        string
+		expectedRes string
+		expectedErr string
+	}{
+		{
+			name:        "placeholder",
+			redactor:    substitute.RedactPlaceholder,
+			body:        body,
+			expectedRes: "user: <redacted:kv/storage/postgres/creds#username>\npass: <redacted:kv/storage/postgres/creds#password>\n",
+		},
+		{
+			name:        "mask",
+			redactor:    substitute.RedactMask,
+			body:        body,
+			expectedRes: "user: ********\npass: *********************************\n",
+		},
+		{
+			// Values are still resolved, errors are reported as usual.
+			name:        "errors-reported",
+			redactor:    substitute.RedactPlaceholder,
+			body:        "@@path=kv/storage/postgres/creds,field=username,transform=wrong@@",
+			expectedErr: "1:1: unknown transformation: wrong",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			b, err := substitute.PatchSecrets(strings.NewReader(c.body), re, client, substitute.WithRedactor(c.redactor))
+			if c.expectedErr != "" {
+				assert.EqualError(err, c.expectedErr)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(c.expectedRes, string(b))
+		})
+	}
+}
+
+func TestRedactMask(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	assert.Equal("", substitute.RedactMask(nil, ""))
+	assert.Equal("*****", substitute.RedactMask(nil, "hünt3"))
+	assert.Equal("**\n***\n", substitute.RedactMask(nil, "ab\ncde\n"))
+}
@@ -0,0 +1,67 @@
+package substitute
+
+import (
+	"errors"
+	"regexp"
+)
+
+// Delimiters of envsubst-style references such as
+// "${vault:kv/storage/postgres/creds#password|trim}", whose specs are parsed by
+// vault.ParseEnvsubstSpec.
+const (
+	EnvsubstOpen  = "${vault:"
+	EnvsubstClose = "}"
+)
+
+// NewRegexp returns a regular expression matching secret references enclosed
+// by the open and close delimiters, which may differ. The spec of each
+// reference is captured by the first capture group. References are matched
+// non-greedily, such that multiple references may appear on a single line.
+//
+// The expression also matches the open delimiter prefixed with a backslash,
+// without capturing a spec. Such escapes are replaced with the literal
+// delimiter by PatchSecrets.
+func NewRegexp(open, close string) (*regexp.Regexp, error) {
+	if open == "" || close == "" {
+		return nil, errors.New("delimiters may not be empty")
+	}
+	o, c := regexp.QuoteMeta(open), regexp.QuoteMeta(close)
+	return regexp.Compile(`\\` + o + `|` + o + `(.*?)` + c)
+}
+
+// isEscape reports whether m, a match of a regexp returned by NewRegexp, is an
+// escaped delimiter rather than a reference.
+func isEscape(m []int) bool {
+	return m[2] < 0
+}
+
+// findMatches returns all matches of regexp in s. In non-strict mode, matches
+// whose spec cannot be parsed are not considered references and omitted. The
+// scan continues at the closing delimiter of such a match, since it may open
+// a subsequent reference.
+func findMatches(s string, regexp *regexp.Regexp, o *options) [][]int {
+	if o.strict {
+		return regexp.FindAllStringSubmatchIndex(s, -1)
+	}
+	var matches [][]int
+	for off := 0; off <= len(s); {
+		m := regexp.FindStringSubmatchIndex(s[off:])
+		if m == nil {
+			break
+		}
+		for i := range m {
+			if m[i] >= 0 {
+				m[i] += off
+			}
+		}
+		if !isEscape(m) {
+			if _, err := o.parser(s[m[2]:m[3]]); err != nil {
+				off = max(m[3], m[0]+1)
+				continue
+			}
+		}
+		matches = append(matches, m)
+		off = max(m[1], m[0]+1)
+	}
+	return matches
+}
@@ -0,0 +1,62 @@
+package substitute_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/substitute"
+)
+
+func TestNewRegexp(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+	client := newMockClient()
+
+	for _, c := range []struct {
+		name        string
+		open, close string
+		body        string
+		expectedRes string
+		expectedErr error
+	}{
+		{
+			name:        "symmetric",
+			open:        "@@",
+			close:       "@@",
+			body:        "@@path=kv/storage/postgres/creds,field=password@@",
+			expectedRes: "4_5tr0ng_4nd_c0mpl1c4t3d_p455w0rd",
+		},
+		{
+			name:        "asymmetric-multiple-per-line",
+			open:        "{{vault ",
+			close:       "}}",
+			body:        "{{vault path=kv/storage/postgres/creds, field=username, b64=true }}:{{vault path=kv/storage/postgres/creds, field=password }} {{ .Values.x }}",
+			expectedRes: "postgres:4_5tr0ng_4nd_c0mpl1c4t3d_p455w0rd {{ .Values.x }}",
+		},
+		{
+			name:        "regexp-metacharacters",
+			open:        "<%",
+			close:       "%>",
+			body:        "user=<% path=kv/storage/postgres/creds,field=username,b64=true,transform=upper %> (.*?)",
+			expectedRes: "user=POSTGRES (.*?)",
+		},
+		{
+			name:        "empty-delimiter",
+			open:        "{{",
+			expectedErr: errors.New("delimiters may not be empty"),
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			re, err := substitute.NewRegexp(c.open, c.close)
+			assert.Equal(c.expectedErr, err)
+			if err != nil {
+				return
+			}
+			b, err := substitute.PatchSecrets(strings.NewReader(c.body), re, client)
+			assert.Nil(err)
+			assert.Equal(c.expectedRes, string(b))
+		})
+	}
+}
@@ -6,26 +6,42 @@ import (
 	"strings"
 )
 
-// Apply applies and returns a given transformation from an input string. An
-// empty string is returned if any errors occur and/or the transformation type
-// is invalid, along with the corresponding error.
-func Apply(transformation string, s string) (string, error) {
-	switch transformation {
-	case "base64":
+var transformations = map[string]func(string) (string, error){
+	"base64": func(s string) (string, error) {
 		return base64.StdEncoding.EncodeToString([]byte(s)), nil
-	case "base64d":
+	},
+	"base64d": func(s string) (string, error) {
 		b, err := base64.StdEncoding.DecodeString(s)
 		if err != nil {
 			return "", err
 		}
 		return string(b), nil
-	case "upper":
+	},
+	"upper": func(s string) (string, error) {
 		return strings.ToUpper(s), nil
-	case "lower":
+	},
+	"lower": func(s string) (string, error) {
 		return strings.ToLower(s), nil
-	case "trim":
+	},
+	"trim": func(s string) (string, error) {
 		return strings.TrimSpace(s), nil
-	default:
-		return "", fmt.Errorf("unknown transformation: %s", transformation)
+	},
+}
+
+// Apply applies and returns a given transformation from an input string. An
+// empty string is returned if any errors occur and/or the transformation type
+// is invalid, along with the corresponding error.
+func Apply(transformation string, s string) (string, error) {
+	if err := Validate(transformation); err != nil {
+		return "", err
+	}
+	return transformations[transformation](s)
+}
+
+// Validate returns an error if the given transformation does not exist.
+func Validate(transformation string) error {
+	if _, ok := transformations[transformation]; !ok {
+		return fmt.Errorf("unknown transformation: %s", transformation)
 	}
+	return nil
 }
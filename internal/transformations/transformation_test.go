@@ -91,3 +91,13 @@ func TestTransformationsChained(t *testing.T) {
 		assert.Equal(c.ExpectedValue, s)
 	}
 }
+
+func TestValidate(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	for _, name := range []string{"base64", "base64d", "upper", "lower", "trim"} {
+		assert.Nil(transformations.Validate(name), name)
+	}
+	assert.Equal(errors.New("unknown transformation: foobarbaz"), transformations.Validate("foobarbaz"))
+}
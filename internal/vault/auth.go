@@ -0,0 +1,138 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// AuthMethod is implemented by login flows which exchange some credential for
+// a vault token.
+type AuthMethod interface {
+	Login(c *api.Client) (*api.Secret, error)
+}
+
+// AppRoleAuth logs into vault using the AppRole auth method. Both the role and
+// secret ID may either be passed directly or read from a file, with direct
+// values taking precedence.
+type AppRoleAuth struct {
+	// Mount is the path the auth method is mounted at, defaults to "approle".
+	Mount        string
+	RoleID       string
+	RoleIDFile   string
+	SecretID     string
+	SecretIDFile string
+}
+
+func (a *AppRoleAuth) Login(c *api.Client) (*api.Secret, error) {
+	roleID, err := readCredential(a.RoleID, a.RoleIDFile)
+	if err != nil {
+		return nil, fmt.Errorf("approle: failed to read role_id: %w", err)
+	}
+	if roleID == "" {
+		return nil, errors.New("approle: role_id may not be empty")
+	}
+	secretID, err := readCredential(a.SecretID, a.SecretIDFile)
+	if err != nil {
+		return nil, fmt.Errorf("approle: failed to read secret_id: %w", err)
+	}
+	return login(c, "approle", a.Mount, map[string]any{
+		"role_id":   roleID,
+		"secret_id": secretID,
+	})
+}
+
+// DefaultKubernetesTokenFile is the path at which kubernetes mounts the
+// projected service account token inside of pods.
+const DefaultKubernetesTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// KubernetesAuth logs into vault using the kubernetes auth method, presenting
+// the pod's service account token.
+type KubernetesAuth struct {
+	// Mount is the path the auth method is mounted at, defaults to "kubernetes".
+	Mount string
+	Role  string
+	// TokenFile is the path of the service account token, defaults to
+	// DefaultKubernetesTokenFile.
+	TokenFile string
+}
+
+func (a *KubernetesAuth) Login(c *api.Client) (*api.Secret, error) {
+	if a.Role == "" {
+		return nil, errors.New("kubernetes: role may not be empty")
+	}
+	file := a.TokenFile
+	if file == "" {
+		file = DefaultKubernetesTokenFile
+	}
+	jwt, err := readCredential("", file)
+	if err != nil {
+		return nil, fmt.Errorf("kubernetes: failed to read service account token: %w", err)
+	}
+	return login(c, "kubernetes", a.Mount, map[string]any{
+		"role": a.Role,
+		"jwt":  jwt,
+	})
+}
+
+// JWTAuth logs into vault using the JWT/OIDC auth method, presenting a
+// workload identity token such as the ID tokens issued by CI providers. The
+// token may either be passed directly or read from a file, with direct values
+// taking precedence.
+type JWTAuth struct {
+	// Mount is the path the auth method is mounted at, defaults to "jwt".
+	Mount     string
+	Role      string
+	Token     string
+	TokenFile string
+}
+
+func (a *JWTAuth) Login(c *api.Client) (*api.Secret, error) {
+	jwt, err := readCredential(a.Token, a.TokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("jwt: failed to read token: %w", err)
+	}
+	if jwt == "" {
+		return nil, errors.New("jwt: token may not be empty")
+	}
+	// The role is optional for this method, vault falls back to the mount's
+	// default role if it is omitted.
+	data := map[string]any{"jwt": jwt}
+	if a.Role != "" {
+		data["role"] = a.Role
+	}
+	return login(c, "jwt", a.Mount, data)
+}
+
+// login writes data to the login endpoint of the auth method mounted at mount
+// (or the method's default mount if empty) and returns the resulting secret.
+func login(c *api.Client, method, mount string, data map[string]any) (*api.Secret, error) {
+	if mount == "" {
+		mount = method
+	}
+	secret, err := c.Logical().Write(fmt.Sprintf("auth/%s/login", strings.Trim(mount, "/")), data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: login failed: %w", method, err)
+	}
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
+		return nil, fmt.Errorf("%s: login failed: no token returned", method)
+	}
+	return secret, nil
+}
+
+// readCredential returns value if it is set, otherwise the contents of file
+// with any trailing newline removed. If neither are set an empty string is
+// returned.
+func readCredential(value, file string) (string, error) {
+	if value != "" || file == "" {
+		return value, nil
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
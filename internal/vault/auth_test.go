@@ -0,0 +1,211 @@
+package vault_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/vault"
+)
+
+func TestAppRoleAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	roleIDFile := path.Join(dir, "role-id")
+	secretIDFile := path.Join(dir, "secret-id")
+	assert.Nil(os.WriteFile(roleIDFile, []byte("file-role\n"), 0o600), "failed to prepare env")
+	assert.Nil(os.WriteFile(secretIDFile, []byte("file-secret\n"), 0o600), "failed to prepare env")
+
+	srv := newFakeLoginServer(t, map[string]map[string]any{
+		"/v1/auth/approle/login": {"role_id": "role", "secret_id": "secret"},
+		"/v1/auth/ci/login":      {"role_id": "file-role", "secret_id": "file-secret"},
+	})
+	t.Setenv("VAULT_ADDR", srv.URL)
+	t.Setenv("VAULT_TOKEN", "stale_token")
+
+	for _, c := range []struct {
+		name        string
+		auth        *vault.AppRoleAuth
+		expectedErr error
+	}{
+		{
+			name: "generic-success",
+			auth: &vault.AppRoleAuth{RoleID: "role", SecretID: "secret"},
+		},
+		{
+			name: "credentials-from-files-custom-mount",
+			auth: &vault.AppRoleAuth{Mount: "ci", RoleIDFile: roleIDFile, SecretIDFile: secretIDFile},
+		},
+		{
+			name:        "missing-role-id",
+			auth:        &vault.AppRoleAuth{SecretID: "secret"},
+			expectedErr: errors.New("approle: role_id may not be empty"),
+		},
+		{
+			name:        "unreadable-secret-id-file",
+			auth:        &vault.AppRoleAuth{RoleID: "role", SecretIDFile: path.Join(dir, "missing")},
+			expectedErr: errors.New("approle: failed to read secret_id: open " + path.Join(dir, "missing") + ": no such file or directory"),
+		},
+		{
+			name:        "invalid-credentials",
+			auth:        &vault.AppRoleAuth{RoleID: "role", SecretID: "wrong"},
+			expectedErr: errors.New("approle: login failed"),
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			client, err := vault.NewClient(c.auth, "")
+			if c.expectedErr != nil {
+				assert.ErrorContains(err, c.expectedErr.Error())
+				assert.Nil(client)
+				return
+			}
+			assert.Nil(err)
+			assert.NotNil(client)
+		})
+	}
+}
+
+func TestKubernetesAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	tokenFile := path.Join(dir, "token")
+	assert.Nil(os.WriteFile(tokenFile, []byte("service.account.jwt"), 0o600), "failed to prepare env")
+
+	srv := newFakeLoginServer(t, map[string]map[string]any{
+		"/v1/auth/kubernetes/login":    {"role": "app", "jwt": "service.account.jwt"},
+		"/v1/auth/k8s/cluster-a/login": {"role": "app", "jwt": "service.account.jwt"},
+	})
+	t.Setenv("VAULT_ADDR", srv.URL)
+
+	for _, c := range []struct {
+		name        string
+		auth        *vault.KubernetesAuth
+		expectedErr error
+	}{
+		{
+			name: "generic-success",
+			auth: &vault.KubernetesAuth{Role: "app", TokenFile: tokenFile},
+		},
+		{
+			name: "custom-mount",
+			auth: &vault.KubernetesAuth{Mount: "/k8s/cluster-a/", Role: "app", TokenFile: tokenFile},
+		},
+		{
+			name:        "missing-role",
+			auth:        &vault.KubernetesAuth{TokenFile: tokenFile},
+			expectedErr: errors.New("kubernetes: role may not be empty"),
+		},
+		{
+			name:        "missing-token-file",
+			auth:        &vault.KubernetesAuth{Role: "app", TokenFile: path.Join(dir, "missing")},
+			expectedErr: errors.New("kubernetes: failed to read service account token"),
+		},
+		{
+			name:        "unknown-role",
+			auth:        &vault.KubernetesAuth{Role: "other", TokenFile: tokenFile},
+			expectedErr: errors.New("kubernetes: login failed"),
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			client, err := vault.NewClient(c.auth, "")
+			if c.expectedErr != nil {
+				assert.ErrorContains(err, c.expectedErr.Error())
+				assert.Nil(client)
+				return
+			}
+			assert.Nil(err)
+			assert.NotNil(client)
+		})
+	}
+}
+
+func TestJWTAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	dir := t.TempDir()
+	tokenFile := path.Join(dir, "id-token")
+	assert.Nil(os.WriteFile(tokenFile, []byte("ci.id.token\n"), 0o600), "failed to prepare env")
+
+	srv := newFakeLoginServer(t, map[string]map[string]any{
+		"/v1/auth/jwt/login":    {"role": "deploy", "jwt": "ci.id.token"},
+		"/v1/auth/gitlab/login": {"jwt": "ci.id.token"},
+	})
+	t.Setenv("VAULT_ADDR", srv.URL)
+
+	for _, c := range []struct {
+		name        string
+		auth        *vault.JWTAuth
+		expectedErr error
+	}{
+		{
+			name: "generic-success",
+			auth: &vault.JWTAuth{Role: "deploy", Token: "ci.id.token"},
+		},
+		{
+			name: "token-from-file-default-role",
+			auth: &vault.JWTAuth{Mount: "gitlab", TokenFile: tokenFile},
+		},
+		{
+			name:        "missing-token",
+			auth:        &vault.JWTAuth{Role: "deploy"},
+			expectedErr: errors.New("jwt: token may not be empty"),
+		},
+		{
+			name:        "wrong-role",
+			auth:        &vault.JWTAuth{Role: "admin", Token: "ci.id.token"},
+			expectedErr: errors.New("jwt: login failed"),
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			client, err := vault.NewClient(c.auth, "")
+			if c.expectedErr != nil {
+				assert.ErrorContains(err, c.expectedErr.Error())
+				assert.Nil(client)
+				return
+			}
+			assert.Nil(err)
+			assert.NotNil(client)
+		})
+	}
+}
+
+// newFakeLoginServer returns a test server which emulates vault login
+// endpoints. Each key in logins is a login endpoint, each value the exact
+// request body required for the login to succeed. Any request carrying a
+// vault token is rejected since login endpoints are expected to be called
+// unauthenticated.
+func newFakeLoginServer(t *testing.T, logins map[string]map[string]any) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		expected, ok := logins[r.URL.Path]
+		if !ok || r.Method != http.MethodPut && r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.Header.Get("X-Vault-Token") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for k, v := range expected {
+			if body[k] != v {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors":["invalid credentials"]}`))
+				return
+			}
+		}
+		_ = json.NewEncoder(w).Encode(&api.Secret{
+			Auth: &api.SecretAuth{ClientToken: "login_token", LeaseDuration: 3600, Renewable: true},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
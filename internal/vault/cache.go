@@ -0,0 +1,39 @@
+package vault
+
+import "github.com/hashicorp/vault/api"
+
+// secretKey identifies a single secret read.
+type secretKey struct {
+	namespace, mount, path, kvVersion string
+	version                           int
+}
+
+type cachedSecret struct {
+	// done is closed once the read has completed.
+	done   chan struct{}
+	secret *api.KVSecret
+	err    error
+}
+
+// cached returns the result of read for key. Read is only called once per key
+// for the lifetime of the client, concurrent callers requesting the same key
+// wait for the first call to complete. Errors are cached as well.
+func (c *Client) cached(key secretKey, read func() (*api.KVSecret, error)) (*api.KVSecret, error) {
+	c.secretsMu.Lock()
+	if c.secrets == nil {
+		c.secrets = make(map[secretKey]*cachedSecret)
+	}
+	e, ok := c.secrets[key]
+	if ok {
+		c.secretsMu.Unlock()
+		<-e.done
+		return e.secret, e.err
+	}
+	e = &cachedSecret{done: make(chan struct{})}
+	c.secrets[key] = e
+	c.secretsMu.Unlock()
+
+	e.secret, e.err = read()
+	close(e.done)
+	return e.secret, e.err
+}
@@ -0,0 +1,53 @@
+package vault_test
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/vault"
+)
+
+func TestClientCache(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	secretStub := &api.KVSecret{Data: map[string]any{"username": "postgres", "password": "hunter2"}}
+	m := &mockKVReader{}
+	m.
+		On("ReadKVv2", "kv", "storage/postgres/creds").Return(secretStub, nil).
+		On("ReadKVv2Version", "kv", "storage/postgres/creds", 1).Return(secretStub, nil).
+		On("ReadKVv1", "kv", "storage/postgres/creds").Return(secretStub, nil).
+		On("ReadKVv2", "kv", "does/not/exist").Return(nil, errors.New("secret not found"))
+	client := &vault.Client{KVReader: m}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, spec := range []*vault.SecretSpec{
+				{Path: "kv/storage/postgres/creds", Field: "username"},
+				{Path: "kv/storage/postgres/creds", Field: "password", Transformations: []string{"upper"}},
+				{Path: "kv/storage/postgres/creds", Field: "password", MountVersion: vault.KVv2},
+				{Path: "kv/storage/postgres/creds", Field: "password", Version: 1},
+				{Path: "kv/storage/postgres/creds", Field: "password", MountVersion: vault.KVv1},
+			} {
+				s, err := client.ReadKV(spec)
+				assert.Nil(err)
+				assert.Equal(secretStub, s)
+			}
+			_, err := client.ReadKV(&vault.SecretSpec{Path: "kv/does/not/exist", Field: "password"})
+			assert.Equal(errors.New("secret not found"), err)
+		}()
+	}
+	wg.Wait()
+
+	// Each distinct secret (by mount, path, kv version and secret version) is
+	// read exactly once, including failed reads.
+	m.AssertNumberOfCalls(t, "ReadKVv2", 2)
+	m.AssertNumberOfCalls(t, "ReadKVv2Version", 1)
+	m.AssertNumberOfCalls(t, "ReadKVv1", 1)
+}
@@ -6,14 +6,29 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
 
 	"github.com/hashicorp/vault/api"
 )
 
 // Client thinly wraps a vault client. It provides a minimal subset of
-// functionality required for interacting with KV stores.
+// functionality required for interacting with KV stores. Secrets are cached
+// for the lifetime of the client, such that each secret is read at most once.
 type Client struct {
 	KVReader KVReader
+	// Namespace is the vault namespace to read secrets from if a spec does not
+	// set one explicitly.
+	Namespace string
+
+	mountsMu sync.Mutex
+	// mounts caches the KV version of each mount resolved so far.
+	mounts map[mountKey]string
+	// lookups holds pending and failed mount lookups by namespace and first
+	// path segment.
+	lookups map[mountKey]*mountLookup
+
+	secretsMu sync.Mutex
+	secrets   map[secretKey]*cachedSecret
 }
 
 const (
@@ -24,49 +39,263 @@ const (
 type KVReader interface {
 	ReadKVv1(mount, path string) (*api.KVSecret, error)
 	ReadKVv2(mount, path string) (*api.KVSecret, error)
+	ReadKVv2Version(mount, path string, version int) (*api.KVSecret, error)
+}
+
+// NamespacedKVReader is implemented by KVReaders which are able to read
+// secrets from a vault namespace other than their own.
+type NamespacedKVReader interface {
+	KVReader
+	InNamespace(ns string) KVReader
 }
 
-type apiClient struct{ *api.Client }
+type apiClient struct {
+	*api.Client
+	tokens    *tokenManager
+	namespace string
+}
+
+func (c *apiClient) InNamespace(ns string) KVReader {
+	return &apiClient{c.Client, c.tokens, ns}
+}
 
-func (c *apiClient) ReadKVv1(mount, path string) (*api.KVSecret, error) {
-	return c.KVv1(mount).Get(context.Background(), path)
+func (c *apiClient) ReadKVv1(mount, path string) (s *api.KVSecret, err error) {
+	err = c.do(func() error {
+		s, err = c.scoped().KVv1(mount).Get(context.Background(), path)
+		return err
+	})
+	return s, err
 }
 
-func (c *apiClient) ReadKVv2(mount, path string) (*api.KVSecret, error) {
-	return c.KVv2(mount).Get(context.Background(), path)
+func (c *apiClient) ReadKVv2(mount, path string) (s *api.KVSecret, err error) {
+	err = c.do(func() error {
+		s, err = c.scoped().KVv2(mount).Get(context.Background(), path)
+		return err
+	})
+	return s, err
 }
 
+func (c *apiClient) ReadKVv2Version(mount, path string, version int) (s *api.KVSecret, err error) {
+	err = c.do(func() error {
+		s, err = c.scoped().KVv2(mount).GetVersion(context.Background(), path, version)
+		return err
+	})
+	return s, err
+}
+
+// scoped returns the underlying client, scoped to the reader's namespace if
+// one is set. Since the token may change over the client's lifetime, the
+// returned client should not be retained across requests.
+func (c *apiClient) scoped() *api.Client {
+	if c.namespace == "" {
+		return c.Client
+	}
+	return c.WithNamespace(c.namespace)
+}
+
+// do performs a request, making sure the client's token is valid beforehand.
+// If the token turns out to have been revoked in the meantime, the request is
+// retried once after logging in again.
+func (c *apiClient) do(fn func() error) error {
+	if err := c.tokens.ensure(); err != nil {
+		return err
+	}
+	token := c.Token()
+	err := fn()
+	if err == nil {
+		return nil
+	}
+	retry, err := c.tokens.handleDenied(token, err)
+	if !retry {
+		return err
+	}
+	return fn()
+}
+
+// ReadKV reads the secret described by spec. Unless given explicitly, the
+// mount serving the secret and its KV version are looked up in vault if
+// supported by the client's reader, with a spec's explicit version taking
+// precedence. Otherwise, the first segment of the spec's path is assumed to be
+// the mount, defaulting to KVv2.
 func (c *Client) ReadKV(spec *SecretSpec) (*api.KVSecret, error) {
-	split := strings.Split(spec.Path, "/")
-	mnt := split[0]
-	// Extra check for second element being empty cause both 'kv/' and 'kv'
+	reader, err := c.reader(spec)
+	if err != nil {
+		return nil, err
+	}
+	loc, err := c.locate(reader, spec)
+	if err != nil {
+		return nil, err
+	}
+	mnt, pth, version := loc.Mount, loc.Path, loc.KVVersion
+	key := secretKey{loc.Namespace, mnt, pth, version, spec.Version}
+	switch {
+	case version == KVv1 && spec.Version != 0:
+		return nil, fmt.Errorf("secret %s: versions can only be pinned on kv v2 mounts", spec.Path)
+	case version == KVv1:
+		return c.cached(key, func() (*api.KVSecret, error) {
+			return reader.ReadKVv1(mnt, pth)
+		})
+	case version == KVv2 && spec.Version != 0:
+		return spec.checkVersion(c.cached(key, func() (*api.KVSecret, error) {
+			return reader.ReadKVv2Version(mnt, pth, spec.Version)
+		}))
+	case version == KVv2:
+		return spec.checkVersion(c.cached(key, func() (*api.KVSecret, error) {
+			return reader.ReadKVv2(mnt, pth)
+		}))
+	}
+	return nil, fmt.Errorf("secret %s: unknown kv version %s", spec, version)
+}
+
+// Location describes where a secret is stored in vault.
+type Location struct {
+	// Namespace is empty for secrets in the root namespace.
+	Namespace string
+	Mount     string
+	// Path is the secret's path relative to Mount.
+	Path      string
+	KVVersion string
+	// Guessed is set if the mount or KV version was neither given explicitly
+	// nor looked up in vault, but assumed from the secret's path.
+	Guessed bool
+}
+
+// DataPath returns the API path used to read the secret's data, relative to
+// its namespace.
+func (l *Location) DataPath() string {
+	if l.KVVersion == KVv2 {
+		return l.Mount + "/data/" + l.Path
+	}
+	return l.Mount + "/" + l.Path
+}
+
+// Locate returns the location of the secret described by spec, determined in
+// the same way as by ReadKV. If the client has no reader, secrets are located
+// without contacting vault.
+func (c *Client) Locate(spec *SecretSpec) (*Location, error) {
+	var reader KVReader
+	if c.KVReader != nil {
+		var err error
+		reader, err = c.reader(spec)
+		if err != nil {
+			return nil, err
+		}
+	}
+	loc, err := c.locate(reader, spec)
+	if err != nil {
+		return nil, err
+	}
+	if loc.KVVersion != KVv1 && loc.KVVersion != KVv2 {
+		return nil, fmt.Errorf("secret %s: unknown kv version %s", spec, loc.KVVersion)
+	}
+	return loc, nil
+}
+
+// checkVersion returns an error if secret is a deleted or destroyed KVv2
+// secret version, as vault only returns the version's metadata for those.
+func (spec *SecretSpec) checkVersion(secret *api.KVSecret, err error) (*api.KVSecret, error) {
+	if err != nil || secret == nil || secret.Data != nil || secret.VersionMetadata == nil {
+		return secret, err
+	}
+	switch md := secret.VersionMetadata; {
+	case md.Destroyed:
+		return nil, fmt.Errorf("secret %s: version %d has been destroyed", spec.Path, md.Version)
+	case !md.DeletionTime.IsZero():
+		return nil, fmt.Errorf("secret %s: version %d has been deleted", spec.Path, md.Version)
+	}
+	return secret, nil
+}
+
+// locate returns the location to use for reading spec. The KV version is not
+// validated.
+func (c *Client) locate(reader KVReader, spec *SecretSpec) (*Location, error) {
+	var (
+		mnt, version string
+		ok, guessed  bool
+	)
+	ns := c.namespace(spec)
+	if spec.Mount == "" || spec.MountVersion == "" {
+		mnt, version, ok = c.resolveMount(reader, ns, spec.Path)
+	}
+	switch {
+	case spec.Mount != "":
+		explicit := strings.Trim(spec.Mount, "/")
+		if !ok || mnt != explicit {
+			version = KVv2
+			guessed = true
+		}
+		mnt = explicit
+		if !strings.HasPrefix(spec.Path, mnt+"/") {
+			return nil, fmt.Errorf("path %s is not below mount %s", spec.Path, mnt)
+		}
+	case !ok:
+		mnt, _, _ = strings.Cut(spec.Path, "/")
+		version = KVv2
+		guessed = true
+	}
+	// Extra check for the remaining path being empty cause both 'kv/' and 'kv'
 	// should be invalid paths.
-	if len(split) < 2 || split[1] == "" {
+	pth, found := strings.CutPrefix(spec.Path, mnt+"/")
+	if !found || pth == "" {
 		return nil, fmt.Errorf("no path to query using mountpoint %s", mnt)
 	}
-	pth := strings.TrimPrefix(spec.Path, mnt+"/")
-	switch spec.MountVersion {
-	case KVv1:
-		return c.KVReader.ReadKVv1(mnt, pth)
-	case KVv2:
-		return c.KVReader.ReadKVv2(mnt, pth)
+	if spec.MountVersion != "" {
+		version = spec.MountVersion
+		// Only the mount may still have been guessed.
+		guessed = spec.Mount == "" && !ok
+	}
+	return &Location{Namespace: ns, Mount: mnt, Path: pth, KVVersion: version, Guessed: guessed}, nil
+}
+
+// namespace returns the namespace to read spec from.
+func (c *Client) namespace(spec *SecretSpec) string {
+	if spec.Namespace != "" {
+		return spec.Namespace
+	}
+	return c.Namespace
+}
+
+// reader returns the KVReader to use for reading spec, scoped to the spec's
+// namespace or the client's default namespace.
+func (c *Client) reader(spec *SecretSpec) (KVReader, error) {
+	ns := c.namespace(spec)
+	if ns == "" {
+		return c.KVReader, nil
 	}
-	return nil, fmt.Errorf("secret %+v: unknown kv version %s", spec, spec.MountVersion)
+	r, ok := c.KVReader.(NamespacedKVReader)
+	if !ok {
+		return nil, fmt.Errorf("secret %s: reader does not support namespaces", spec.Path)
+	}
+	return r.InNamespace(ns), nil
 }
 
 // NewClient returns a new vault client. Address and token initialization are
-// handled internally. Any errors encountered during initialization (for
-// instance due to lacking environment variables) are returned to the caller.
-func NewClient() (*Client, error) {
-	c := &Client{}
+// handled internally. If auth is non-nil, it is used to log in and obtain a
+// token, otherwise the token is read from VAULT_TOKEN or ~/.vault-token. The
+// token is renewed as needed for the lifetime of the client, falling back to
+// logging in again via auth once it can no longer be renewed. If namespace is
+// non-empty, it is used for logging in and as the client's default namespace,
+// otherwise VAULT_NAMESPACE is respected. Any errors encountered during
+// initialization (for instance due to lacking environment variables) are
+// returned to the caller.
+func NewClient(auth AuthMethod, namespace string) (*Client, error) {
+	c := &Client{Namespace: namespace}
 
 	api, err := api.NewClient(nil)
 	if err != nil {
 		return nil, err
 	}
+	if namespace != "" {
+		api.SetNamespace(namespace)
+	}
 
-	// Try to read from ~/.vault-token if env var is not supplied.
-	if os.Getenv("VAULT_TOKEN") == "" {
+	tokens := &tokenManager{client: api, auth: auth}
+	if auth != nil {
+		if err := tokens.login(); err != nil {
+			return nil, err
+		}
+	} else if os.Getenv("VAULT_TOKEN") == "" {
+		// Try to read from ~/.vault-token if env var is not supplied.
 		homeDir, err := os.UserHomeDir()
 		if err != nil {
 			return nil, fmt.Errorf("VAULT_TOKEN unset and/or failed to read token from ~/.vault-token: %s", err)
@@ -78,6 +307,6 @@ func NewClient() (*Client, error) {
 		api.SetToken(strings.TrimSuffix(string(token), "\n"))
 	}
 
-	c.KVReader = &apiClient{api}
+	c.KVReader = &apiClient{api, tokens, ""}
 	return c, nil
 }
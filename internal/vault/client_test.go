@@ -6,6 +6,7 @@ import (
 	"path"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/stretchr/testify/assert"
@@ -63,7 +64,7 @@ func TestClientConstruction(t *testing.T) {
 				}
 				assert.Nil(os.WriteFile(path.Join(home, ".vault-token"), []byte("super_secret_token"), 0o600), "failed to prepare env")
 			}
-			client, err := vault.NewClient()
+			client, err := vault.NewClient(nil, "")
 			assert.Equal(c.expected, err)
 			if c.expected == nil {
 				assert.NotNil(client)
@@ -86,6 +87,14 @@ func TestClientReadKV(t *testing.T) {
 	m.
 		On("ReadKVv1", "kv", "storage/postgres/creds").Return(secretStub, nil).
 		On("ReadKVv2", "kv", "storage/postgres/creds").Return(secretStub, nil).
+		On("ReadKVv2", "teams/payments/kv", "postgres/creds").Return(secretStub, nil).
+		On("ReadKVv2Version", "kv", "storage/postgres/creds", 3).Return(secretStub, nil).
+		On("ReadKVv2Version", "kv", "storage/postgres/creds", 4).Return(&api.KVSecret{
+		VersionMetadata: &api.KVVersionMetadata{Version: 4, DeletionTime: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}, nil).
+		On("ReadKVv2Version", "kv", "storage/postgres/creds", 5).Return(&api.KVSecret{
+		VersionMetadata: &api.KVVersionMetadata{Version: 5, Destroyed: true},
+	}, nil).
 		On("ReadKVv1", mock.Anything, mock.Anything).Return(nil, nil).
 		On("ReadKVv2", mock.Anything, mock.Anything).Return(nil, nil)
 
@@ -114,9 +123,72 @@ func TestClientReadKV(t *testing.T) {
 				MountVersion: vault.KVv1,
 			},
 		},
+		{
+			name:     "default-kv-mount-version",
+			expected: nil,
+			spec: &vault.SecretSpec{
+				Path:  "kv/storage/postgres/creds",
+				Field: "username",
+			},
+		},
+		{
+			name:     "explicit-mount",
+			expected: nil,
+			spec: &vault.SecretSpec{
+				Path:  "teams/payments/kv/postgres/creds",
+				Field: "username",
+				Mount: "teams/payments/kv",
+			},
+		},
+		{
+			name:     "path-outside-explicit-mount",
+			expected: errors.New("path kv/postgres/creds is not below mount teams/payments/kv"),
+			spec: &vault.SecretSpec{
+				Path:  "kv/postgres/creds",
+				Field: "username",
+				Mount: "teams/payments/kv",
+			},
+		},
+		{
+			name:     "pinned-version",
+			expected: nil,
+			spec: &vault.SecretSpec{
+				Path:    "kv/storage/postgres/creds",
+				Field:   "username",
+				Version: 3,
+			},
+		},
+		{
+			name:     "pinned-version-deleted",
+			expected: errors.New("secret kv/storage/postgres/creds: version 4 has been deleted"),
+			spec: &vault.SecretSpec{
+				Path:    "kv/storage/postgres/creds",
+				Field:   "username",
+				Version: 4,
+			},
+		},
+		{
+			name:     "pinned-version-destroyed",
+			expected: errors.New("secret kv/storage/postgres/creds: version 5 has been destroyed"),
+			spec: &vault.SecretSpec{
+				Path:    "kv/storage/postgres/creds",
+				Field:   "username",
+				Version: 5,
+			},
+		},
+		{
+			name:     "pinned-version-kv-v1",
+			expected: errors.New("secret kv/storage/postgres/creds: versions can only be pinned on kv v2 mounts"),
+			spec: &vault.SecretSpec{
+				Path:         "kv/storage/postgres/creds",
+				Field:        "username",
+				MountVersion: vault.KVv1,
+				Version:      3,
+			},
+		},
 		{
 			name:     "invalid-kv-mount-version",
-			expected: errors.New("secret &{Path:kv/storage/postgres/creds Field:username B64:false MountVersion:wrong Transformations:[]}: unknown kv version wrong"),
+			expected: errors.New("secret kv/storage/postgres/creds#username: unknown kv version wrong"),
 			spec: &vault.SecretSpec{
 				Path:         "kv/storage/postgres/creds",
 				Field:        "username",
@@ -138,6 +210,77 @@ func TestClientReadKV(t *testing.T) {
 			assert.Equal(c.expected, err)
 		})
 	}
+	m.AssertCalled(t, "ReadKVv2", "kv", "storage/postgres/creds")
+	m.AssertCalled(t, "ReadKVv2", "teams/payments/kv", "postgres/creds")
+}
+
+func TestClientNamespaces(t *testing.T) {
+	assert := assert.New(t)
+	newFakeVault(t, 3600)
+	t.Setenv("VAULT_TOKEN", "root")
+	t.Setenv("VAULT_NAMESPACE", "")
+
+	for _, c := range []struct {
+		name       string
+		namespace  string
+		spec       *vault.SecretSpec
+		expectedNS string
+	}{
+		{
+			name:       "no-namespace",
+			spec:       &vault.SecretSpec{Path: "kv/app", Field: "password", MountVersion: vault.KVv2},
+			expectedNS: "",
+		},
+		{
+			name:       "global-namespace",
+			namespace:  "org",
+			spec:       &vault.SecretSpec{Path: "kv/app", Field: "password", MountVersion: vault.KVv2},
+			expectedNS: "org",
+		},
+		{
+			name:       "spec-namespace",
+			spec:       &vault.SecretSpec{Path: "kv/app", Field: "password", MountVersion: vault.KVv2, Namespace: "team-a"},
+			expectedNS: "team-a",
+		},
+		{
+			name:       "spec-namespace-overrides-global",
+			namespace:  "org",
+			spec:       &vault.SecretSpec{Path: "kv/app", Field: "password", MountVersion: vault.KVv2, Namespace: "org/team-b"},
+			expectedNS: "org/team-b",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			client, err := vault.NewClient(nil, c.namespace)
+			assert.Nil(err)
+			secret, err := client.ReadKV(c.spec)
+			assert.Nil(err)
+			assert.Equal(c.expectedNS, secret.Data["namespace"])
+		})
+	}
+}
+
+func TestClientReadKVVersion(t *testing.T) {
+	assert := assert.New(t)
+	newFakeVault(t, 3600)
+	t.Setenv("VAULT_TOKEN", "root")
+	client, err := vault.NewClient(nil, "")
+	assert.Nil(err)
+
+	secret, err := client.ReadKV(&vault.SecretSpec{Path: "kv/app", Field: "password", Version: 3})
+	assert.Nil(err)
+	assert.Equal(3, secret.VersionMetadata.Version)
+
+	_, err = client.ReadKV(&vault.SecretSpec{Path: "kv/app", Field: "password", Version: 2})
+	assert.Equal(errors.New("secret kv/app: version 2 has been deleted"), err)
+}
+
+func TestClientNamespacesUnsupported(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	client := &vault.Client{KVReader: &mockKVReader{}, Namespace: "org"}
+	_, err := client.ReadKV(&vault.SecretSpec{Path: "kv/app", Field: "password", MountVersion: vault.KVv2})
+	assert.Equal(errors.New("secret kv/app: reader does not support namespaces"), err)
 }
 
 type mockKVReader struct{ mock.Mock }
@@ -163,3 +306,14 @@ func (m *mockKVReader) ReadKVv2(mount, path string) (*api.KVSecret, error) {
 	//nolint:forcetypeassert,errcheck // for testing purposes this is fine.
 	return s.(*api.KVSecret), err
 }
+
+func (m *mockKVReader) ReadKVv2Version(mount, path string, version int) (*api.KVSecret, error) {
+	args := m.Called(mount, path, version)
+	s := args.Get(0)
+	err := args.Error(1)
+	if s == nil {
+		return nil, err
+	}
+	//nolint:forcetypeassert,errcheck // for testing purposes this is fine.
+	return s.(*api.KVSecret), err
+}
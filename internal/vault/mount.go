@@ -0,0 +1,115 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// MountResolver is implemented by KVReaders which are able to look up the KV
+// mount serving a given path, along with the mount's KV version.
+type MountResolver interface {
+	ResolveMount(path string) (mount, version string, err error)
+}
+
+func (c *apiClient) ResolveMount(path string) (string, string, error) {
+	var secret *api.Secret
+	err := c.do(func() (err error) {
+		secret, err = c.scoped().Logical().Read("sys/internal/ui/mounts/" + path)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if secret == nil || secret.Data == nil {
+		return "", "", fmt.Errorf("no mount found for path %s", path)
+	}
+	mount, _ := secret.Data["path"].(string)
+	mount = strings.Trim(mount, "/")
+	if mount == "" {
+		return "", "", fmt.Errorf("no mount found for path %s", path)
+	}
+	if typ, _ := secret.Data["type"].(string); typ != "kv" && typ != "generic" {
+		return "", "", fmt.Errorf("mount %s is not a kv mount (type %s)", mount, typ)
+	}
+	version := KVv1
+	if opts, ok := secret.Data["options"].(map[string]any); ok && opts["version"] == "2" {
+		version = KVv2
+	}
+	return mount, version, nil
+}
+
+type mountKey struct{ namespace, mount string }
+
+// mountLookup is a lookup of the mount serving paths below a namespace's first
+// path segment.
+type mountLookup struct {
+	// done is closed once the lookup has completed.
+	done   chan struct{}
+	failed bool
+}
+
+// resolveMount returns the mount and KV version serving path, using the
+// client's mount cache if possible. False is returned if the mount could not
+// be resolved, either because the reader does not support resolving mounts or
+// because the lookup failed.
+//
+// Lookups are performed without holding the cache's lock. Concurrent lookups
+// of paths sharing the same first segment wait for the first one to complete.
+// Failed lookups are cached per first segment, such that a token lacking
+// permission to look up mounts does not cause a lookup for every secret.
+func (c *Client) resolveMount(reader KVReader, ns, path string) (string, string, bool) {
+	r, ok := reader.(MountResolver)
+	if !ok {
+		return "", "", false
+	}
+	segment, _, _ := strings.Cut(path, "/")
+	key := mountKey{ns, segment}
+	for {
+		c.mountsMu.Lock()
+		var mount, version string
+		for k, v := range c.mounts {
+			if k.namespace == ns && len(k.mount) > len(mount) && strings.HasPrefix(path, k.mount+"/") {
+				mount, version = k.mount, v
+			}
+		}
+		if mount != "" {
+			c.mountsMu.Unlock()
+			return mount, version, true
+		}
+		if l, ok := c.lookups[key]; ok {
+			c.mountsMu.Unlock()
+			<-l.done
+			if l.failed {
+				return "", "", false
+			}
+			// The completed lookup may have resolved a different mount below the
+			// same segment, check the cache again.
+			continue
+		}
+		l := &mountLookup{done: make(chan struct{})}
+		if c.lookups == nil {
+			c.lookups = make(map[mountKey]*mountLookup)
+		}
+		c.lookups[key] = l
+		c.mountsMu.Unlock()
+
+		mount, version, err := r.ResolveMount(path)
+
+		c.mountsMu.Lock()
+		if err != nil {
+			l.failed = true
+		} else {
+			// Only failed lookups are retained.
+			delete(c.lookups, key)
+			if c.mounts == nil {
+				c.mounts = make(map[mountKey]string)
+			}
+			c.mounts[mountKey{ns, mount}] = version
+		}
+		c.mountsMu.Unlock()
+		close(l.done)
+		return mount, version, err == nil
+	}
+}
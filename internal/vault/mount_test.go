@@ -0,0 +1,201 @@
+package vault_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/vault"
+)
+
+func TestClientMountResolution(t *testing.T) {
+	assert := assert.New(t)
+	v := newFakeVault(t, 3600)
+	v.mounts = map[string]string{
+		"kv":                "2",
+		"kv1":               "1",
+		"teams/payments/kv": "2",
+	}
+	t.Setenv("VAULT_TOKEN", "root")
+	client, err := vault.NewClient(nil, "")
+	assert.Nil(err)
+
+	for _, c := range []struct {
+		name          string
+		spec          *vault.SecretSpec
+		expectedMount string
+		expectedPath  string
+		expectedErr   string
+	}{
+		{
+			name:          "kv-v2-mount",
+			spec:          &vault.SecretSpec{Path: "kv/storage/postgres/creds", Field: "password"},
+			expectedMount: "kv",
+			expectedPath:  "storage/postgres/creds",
+		},
+		{
+			name:          "kv-v1-mount",
+			spec:          &vault.SecretSpec{Path: "kv1/storage/postgres/creds", Field: "password"},
+			expectedMount: "kv1",
+			expectedPath:  "storage/postgres/creds",
+		},
+		{
+			name:          "nested-mount",
+			spec:          &vault.SecretSpec{Path: "teams/payments/kv/app/db", Field: "password"},
+			expectedMount: "teams/payments/kv",
+			expectedPath:  "app/db",
+		},
+		{
+			name:          "cached-mount",
+			spec:          &vault.SecretSpec{Path: "teams/payments/kv/app/api", Field: "password"},
+			expectedMount: "teams/payments/kv",
+			expectedPath:  "app/api",
+		},
+		{
+			name:          "explicit-mount",
+			spec:          &vault.SecretSpec{Path: "kv1/storage/postgres/creds", Field: "password", Mount: "kv1"},
+			expectedMount: "kv1",
+			expectedPath:  "storage/postgres/creds",
+		},
+		{
+			// The explicit version takes precedence, so the KVv1 mount is queried
+			// as a KVv2 mount and the response cannot be parsed.
+			name:        "explicit-version-override",
+			spec:        &vault.SecretSpec{Path: "kv1/storage/postgres/creds", Field: "password", MountVersion: vault.KVv2},
+			expectedErr: "missing expected 'data' element",
+		},
+		{
+			name:        "missing-path-below-nested-mount",
+			spec:        &vault.SecretSpec{Path: "teams/payments/kv/", Field: "password"},
+			expectedErr: "no path to query using mountpoint teams/payments/kv",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			secret, err := client.ReadKV(c.spec)
+			if c.expectedErr != "" {
+				assert.ErrorContains(err, c.expectedErr)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(c.expectedMount, secret.Data["mount"])
+			assert.Equal(c.expectedPath, secret.Data["path"])
+		})
+	}
+	// One lookup for each distinct mount.
+	assert.Equal(3, v.mountLookups)
+}
+
+func TestClientMountResolutionFallback(t *testing.T) {
+	assert := assert.New(t)
+	v := newFakeVault(t, 3600)
+	t.Setenv("VAULT_TOKEN", "root")
+	client, err := vault.NewClient(nil, "")
+	assert.Nil(err)
+
+	// Mounts which cannot be resolved fall back to the first path segment.
+	_, err = client.ReadKV(&vault.SecretSpec{Path: "unknown/app", Field: "password"})
+	assert.ErrorContains(err, "unknown/data/app")
+	assert.Equal(1, v.mountLookups)
+
+	// Failed lookups are cached.
+	_, err = client.ReadKV(&vault.SecretSpec{Path: "unknown/other", Field: "password"})
+	assert.ErrorContains(err, "unknown/data/other")
+	assert.Equal(1, v.mountLookups)
+}
+
+func TestClientMountResolutionConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	v := newFakeVault(t, 3600)
+	t.Setenv("VAULT_TOKEN", "root")
+	client, err := vault.NewClient(nil, "")
+	assert.Nil(err)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 16)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = client.ReadKV(&vault.SecretSpec{Path: fmt.Sprintf("kv/app-%d", i), Field: "password"})
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.Nil(err)
+	}
+	// Concurrent reads below the same mount wait for a single lookup.
+	assert.Equal(1, v.mountLookups)
+}
+
+func TestClientLocate(t *testing.T) {
+	assert := assert.New(t)
+	v := newFakeVault(t, 3600)
+	v.mounts = map[string]string{"kv": "2", "kv1": "1"}
+	t.Setenv("VAULT_TOKEN", "root")
+	online, err := vault.NewClient(nil, "")
+	assert.Nil(err)
+	offline := &vault.Client{Namespace: "org"}
+
+	for _, c := range []struct {
+		name             string
+		client           *vault.Client
+		spec             *vault.SecretSpec
+		expected         *vault.Location
+		expectedDataPath string
+		expectedErr      string
+	}{
+		{
+			name:             "online-kv-v1",
+			client:           online,
+			spec:             &vault.SecretSpec{Path: "kv1/app/db", Field: "password"},
+			expected:         &vault.Location{Mount: "kv1", Path: "app/db", KVVersion: vault.KVv1},
+			expectedDataPath: "kv1/app/db",
+		},
+		{
+			name:             "online-kv-v2",
+			client:           online,
+			spec:             &vault.SecretSpec{Path: "kv/app/db", Field: "password"},
+			expected:         &vault.Location{Mount: "kv", Path: "app/db", KVVersion: vault.KVv2},
+			expectedDataPath: "kv/data/app/db",
+		},
+		{
+			name:             "offline-default",
+			client:           offline,
+			spec:             &vault.SecretSpec{Path: "kv1/app/db", Field: "password"},
+			expected:         &vault.Location{Namespace: "org", Mount: "kv1", Path: "app/db", KVVersion: vault.KVv2, Guessed: true},
+			expectedDataPath: "kv1/data/app/db",
+		},
+		{
+			name:             "offline-explicit",
+			client:           offline,
+			spec:             &vault.SecretSpec{Path: "teams/kv/app/db", Field: "password", Mount: "teams/kv", MountVersion: vault.KVv1, Namespace: "org/team-a"},
+			expected:         &vault.Location{Namespace: "org/team-a", Mount: "teams/kv", Path: "app/db", KVVersion: vault.KVv1},
+			expectedDataPath: "teams/kv/app/db",
+		},
+		{
+			name:             "offline-explicit-version",
+			client:           offline,
+			spec:             &vault.SecretSpec{Path: "kv1/app/db", Field: "password", MountVersion: vault.KVv1},
+			expected:         &vault.Location{Namespace: "org", Mount: "kv1", Path: "app/db", KVVersion: vault.KVv1, Guessed: true},
+			expectedDataPath: "kv1/app/db",
+		},
+		{
+			name:        "offline-unknown-version",
+			client:      offline,
+			spec:        &vault.SecretSpec{Path: "kv/app/db", Field: "password", MountVersion: "v3"},
+			expectedErr: "secret kv/app/db#password: unknown kv version v3",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			loc, err := c.client.Locate(c.spec)
+			if c.expectedErr != "" {
+				assert.EqualError(err, c.expectedErr)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(c.expected, loc)
+			assert.Equal(c.expectedDataPath, loc.DataPath())
+		})
+	}
+}
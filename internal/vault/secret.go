@@ -3,7 +3,9 @@ package vault
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/mitchellh/mapstructure"
@@ -17,6 +19,42 @@ type SecretSpec struct {
 	B64             bool     `mapstructure:"b64"`
 	MountVersion    string   `mapstructure:"ver"`
 	Transformations []string `mapstructure:"transform"`
+	Namespace       string   `mapstructure:"ns"`
+	Mount           string   `mapstructure:"mount"`
+	// Version pins the KVv2 secret version to read, zero reads the latest
+	// version.
+	Version int `mapstructure:"version"`
+	// Meta selects a KVv2 metadata value instead of a data field. Either one of
+	// "version", "created_time", "deletion_time", "destroyed" or a custom
+	// metadata key prefixed with "custom.".
+	Meta string `mapstructure:"meta"`
+}
+
+// String returns a short description of the secret referenced by the spec in
+// the form "path#field", or "path#meta:key" for metadata.
+func (spec *SecretSpec) String() string {
+	if spec.Meta != "" {
+		return spec.Path + "#meta:" + spec.Meta
+	}
+	return spec.Path + "#" + spec.Field
+}
+
+// Validate checks the parts of the spec which do not depend on the secret
+// itself, namely the names of its transformations and metadata.
+func (spec *SecretSpec) Validate() error {
+	for _, t := range spec.Transformations {
+		if err := transformations.Validate(t); err != nil {
+			return err
+		}
+	}
+	if spec.Meta != "" && !strings.HasPrefix(spec.Meta, "custom.") {
+		switch spec.Meta {
+		case "version", "created_time", "deletion_time", "destroyed":
+		default:
+			return fmt.Errorf("unknown metadata: %s", spec.Meta)
+		}
+	}
+	return nil
 }
 
 // FormatSecret returns a formatted secret value field from a vault KV secret,
@@ -31,9 +69,17 @@ func (spec *SecretSpec) FormatSecret(secret *api.KVSecret) (string, error) {
 		return "", errors.New("secret is nil")
 	}
 
-	res, ok := secret.Data[spec.Field].(string)
-	if !ok {
-		return "", fmt.Errorf("could not cast data at field %s to string", spec.Field)
+	if spec.Meta != "" {
+		res, err = spec.metadata(secret)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		var ok bool
+		res, ok = secret.Data[spec.Field].(string)
+		if !ok {
+			return "", fmt.Errorf("could not cast data at field %s to string", spec.Field)
+		}
 	}
 
 	if spec.B64 {
@@ -53,6 +99,37 @@ func (spec *SecretSpec) FormatSecret(secret *api.KVSecret) (string, error) {
 	return res, nil
 }
 
+// metadata returns the metadata value selected by the spec's Meta field.
+func (spec *SecretSpec) metadata(secret *api.KVSecret) (string, error) {
+	if key, ok := strings.CutPrefix(spec.Meta, "custom."); ok {
+		v, ok := secret.CustomMetadata[key]
+		if !ok {
+			return "", fmt.Errorf("no custom metadata %s", key)
+		}
+		return fmt.Sprint(v), nil
+	}
+
+	md := secret.VersionMetadata
+	if md == nil {
+		return "", errors.New("secret has no metadata")
+	}
+	switch spec.Meta {
+	case "version":
+		return strconv.Itoa(md.Version), nil
+	case "created_time":
+		return md.CreatedTime.Format(time.RFC3339Nano), nil
+	case "deletion_time":
+		if md.DeletionTime.IsZero() {
+			return "", nil
+		}
+		return md.DeletionTime.Format(time.RFC3339Nano), nil
+	case "destroyed":
+		return strconv.FormatBool(md.Destroyed), nil
+	default:
+		return "", fmt.Errorf("unknown metadata: %s", spec.Meta)
+	}
+}
+
 // NewSecretSpec constructs and returns a new SecretSpec from a structured string s.
 func NewSecretSpec(s string) (*SecretSpec, error) {
 	// "path = ...,field = ..." => "path=...,field=...".
@@ -88,18 +165,57 @@ func NewSecretSpec(s string) (*SecretSpec, error) {
 		return nil, err
 	}
 
+	if err := spec.checkAttributes(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// ParseEnvsubstSpec parses a spec in the short syntax used by envsubst-style
+// references, "path#field|transform|...". Metadata is selected by "meta:KEY"
+// in place of the field, for example "path#meta:custom.owner".
+func ParseEnvsubstSpec(s string) (*SecretSpec, error) {
+	s = strings.TrimSpace(s)
+	pth, rest, ok := strings.Cut(s, "#")
+	if !ok {
+		return nil, fmt.Errorf("unable to parse spec: %s (expected path#field)", s)
+	}
+	parts := strings.Split(rest, "|")
+	spec := &SecretSpec{Path: strings.TrimSpace(pth)}
+	target := strings.TrimSpace(parts[0])
+	if meta, ok := strings.CutPrefix(target, "meta:"); ok {
+		spec.Meta = meta
+	} else {
+		spec.Field = target
+	}
+	for _, t := range parts[1:] {
+		spec.Transformations = append(spec.Transformations, strings.TrimSpace(t))
+	}
+	if err := spec.checkAttributes(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// checkAttributes validates the combination of attributes set on a freshly
+// parsed spec.
+func (spec *SecretSpec) checkAttributes() error {
 	// Some light validation on the decoded spec string. Without a path/field to
 	// query, we are kind of useless.
 	if spec.Path == "" {
-		return nil, fmt.Errorf("path may not be empty")
+		return fmt.Errorf("path may not be empty")
 	}
-	if spec.Field == "" {
-		return nil, fmt.Errorf("field may not be empty")
+	if spec.Field == "" && spec.Meta == "" {
+		return fmt.Errorf("field may not be empty")
 	}
-	// Default to KVv2 unless specified otherwise.
-	if spec.MountVersion == "" {
-		spec.MountVersion = KVv2
+	if spec.Field != "" && spec.Meta != "" {
+		return fmt.Errorf("field and meta may not be set at the same time")
 	}
-
-	return spec, nil
+	if spec.Version < 0 {
+		return fmt.Errorf("invalid version %d", spec.Version)
+	}
+	if spec.Mount != "" && !strings.HasPrefix(spec.Path, strings.Trim(spec.Mount, "/")+"/") {
+		return fmt.Errorf("path %s is not below mount %s", spec.Path, spec.Mount)
+	}
+	return nil
 }
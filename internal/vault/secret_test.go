@@ -3,6 +3,7 @@ package vault_test
 import (
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/stretchr/testify/assert"
@@ -26,7 +27,8 @@ func TestSecretSpecParsing(t *testing.T) {
 				Field:           "password",
 				B64:             false,
 				Transformations: nil,
-				MountVersion:    vault.KVv2,
+				// Left empty for the client to detect.
+				MountVersion: "",
 			},
 			expectedErr: nil,
 			name:        "parse-generic",
@@ -38,7 +40,6 @@ func TestSecretSpecParsing(t *testing.T) {
 				Field:           "username",
 				B64:             true,
 				Transformations: []string{"trim", "upper"},
-				MountVersion:    vault.KVv2,
 			},
 			expectedErr: nil,
 			name:        "parse-transforms",
@@ -68,13 +69,69 @@ func TestSecretSpecParsing(t *testing.T) {
 			// This is the job of the vault client, see ReadKV() in client.go.
 			name: "parse-invalid-kv-version",
 		},
+		{
+			parseStr: "path=kv/storage/postgres/creds,field=password,ns=org/team-a",
+			expectedValue: &vault.SecretSpec{
+				Path:      "kv/storage/postgres/creds",
+				Field:     "password",
+				Namespace: "org/team-a",
+			},
+			expectedErr: nil,
+			name:        "parse-namespace",
+		},
+		{
+			parseStr: "path=teams/payments/kv/postgres/creds,field=password,mount=teams/payments/kv",
+			expectedValue: &vault.SecretSpec{
+				Path:  "teams/payments/kv/postgres/creds",
+				Field: "password",
+				Mount: "teams/payments/kv",
+			},
+			expectedErr: nil,
+			name:        "parse-mount",
+		},
+		{
+			parseStr:      "path=kv/postgres/creds,field=password,mount=teams/payments/kv",
+			expectedValue: nil,
+			expectedErr:   errors.New("path kv/postgres/creds is not below mount teams/payments/kv"),
+			name:          "path-outside-mount",
+		},
+		{
+			parseStr: "path=kv/storage/postgres/creds,field=password,version=3",
+			expectedValue: &vault.SecretSpec{
+				Path:    "kv/storage/postgres/creds",
+				Field:   "password",
+				Version: 3,
+			},
+			expectedErr: nil,
+			name:        "parse-version",
+		},
+		{
+			parseStr:      "path=kv/storage/postgres/creds,field=password,version=-1",
+			expectedValue: nil,
+			expectedErr:   errors.New("invalid version -1"),
+			name:          "parse-invalid-version",
+		},
+		{
+			parseStr: "path=kv/storage/postgres/creds,meta=custom.owner",
+			expectedValue: &vault.SecretSpec{
+				Path: "kv/storage/postgres/creds",
+				Meta: "custom.owner",
+			},
+			expectedErr: nil,
+			name:        "parse-meta",
+		},
+		{
+			parseStr:      "path=kv/storage/postgres/creds,field=password,meta=version",
+			expectedValue: nil,
+			expectedErr:   errors.New("field and meta may not be set at the same time"),
+			name:          "field-and-meta",
+		},
 		{
 			parseStr: "path =       kv/storage/postgres/creds ,    field= username,b64=true",
 			expectedValue: &vault.SecretSpec{
-				Path:         "kv/storage/postgres/creds",
-				Field:        "username",
-				B64:          true,
-				MountVersion: vault.KVv2,
+				Path:  "kv/storage/postgres/creds",
+				Field: "username",
+				B64:   true,
 			},
 			expectedErr: nil,
 			name:        "parse-trim-spaces",
@@ -121,6 +178,13 @@ func TestSecretFormatting(t *testing.T) {
 			"username": "cG9zdGdyZXM=",
 			"password": "4_5tr0ng_4nd_c0mpl1c4t3d_p455w0rd",
 		},
+		VersionMetadata: &api.KVVersionMetadata{
+			Version:     7,
+			CreatedTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		CustomMetadata: map[string]any{
+			"owner": "payments",
+		},
 	}
 
 	for _, c := range []struct {
@@ -161,6 +225,67 @@ func TestSecretFormatting(t *testing.T) {
 			secret:        dummySecret,
 			name:          "nonexistent-field",
 		},
+		{
+			spec: &vault.SecretSpec{
+				Path: "kv/storage/postgres/creds",
+				Meta: "version",
+			},
+			expectedValue: "7",
+			expectedErr:   nil,
+			secret:        dummySecret,
+			name:          "meta-version",
+		},
+		{
+			spec: &vault.SecretSpec{
+				Path: "kv/storage/postgres/creds",
+				Meta: "created_time",
+			},
+			expectedValue: "2024-01-02T03:04:05Z",
+			expectedErr:   nil,
+			secret:        dummySecret,
+			name:          "meta-created-time",
+		},
+		{
+			spec: &vault.SecretSpec{
+				Path:            "kv/storage/postgres/creds",
+				Meta:            "custom.owner",
+				Transformations: []string{"upper"},
+			},
+			expectedValue: "PAYMENTS",
+			expectedErr:   nil,
+			secret:        dummySecret,
+			name:          "meta-custom",
+		},
+		{
+			spec: &vault.SecretSpec{
+				Path: "kv/storage/postgres/creds",
+				Meta: "custom.team",
+			},
+			expectedValue: "",
+			expectedErr:   errors.New("no custom metadata team"),
+			secret:        dummySecret,
+			name:          "meta-custom-nonexistent",
+		},
+		{
+			spec: &vault.SecretSpec{
+				Path: "kv/storage/postgres/creds",
+				Meta: "size",
+			},
+			expectedValue: "",
+			expectedErr:   errors.New("unknown metadata: size"),
+			secret:        dummySecret,
+			name:          "meta-unknown",
+		},
+		{
+			spec: &vault.SecretSpec{
+				Path: "kv1/storage/postgres/creds",
+				Meta: "version",
+			},
+			expectedValue: "",
+			expectedErr:   errors.New("secret has no metadata"),
+			secret:        &api.KVSecret{Data: dummySecret.Data},
+			name:          "meta-kv-v1",
+		},
 	} {
 		t.Run(c.name, func(t *testing.T) {
 			s, err := c.spec.FormatSecret(c.secret)
@@ -169,3 +294,96 @@ func TestSecretFormatting(t *testing.T) {
 		})
 	}
 }
+
+func TestSecretSpecValidation(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	for _, c := range []struct {
+		name        string
+		spec        *vault.SecretSpec
+		expectedStr string
+		expectedErr error
+	}{
+		{
+			name:        "valid-field",
+			spec:        &vault.SecretSpec{Path: "kv/storage/postgres/creds", Field: "password", Transformations: []string{"trim", "upper"}},
+			expectedStr: "kv/storage/postgres/creds#password",
+		},
+		{
+			name:        "valid-meta",
+			spec:        &vault.SecretSpec{Path: "kv/storage/postgres/creds", Meta: "custom.owner"},
+			expectedStr: "kv/storage/postgres/creds#meta:custom.owner",
+		},
+		{
+			name:        "unknown-transformation",
+			spec:        &vault.SecretSpec{Path: "kv/storage/postgres/creds", Field: "password", Transformations: []string{"trim", "wrong"}},
+			expectedStr: "kv/storage/postgres/creds#password",
+			expectedErr: errors.New("unknown transformation: wrong"),
+		},
+		{
+			name:        "unknown-meta",
+			spec:        &vault.SecretSpec{Path: "kv/storage/postgres/creds", Meta: "size"},
+			expectedStr: "kv/storage/postgres/creds#meta:size",
+			expectedErr: errors.New("unknown metadata: size"),
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(c.expectedStr, c.spec.String())
+			assert.Equal(c.expectedErr, c.spec.Validate())
+		})
+	}
+}
+
+func TestEnvsubstSpecParsing(t *testing.T) {
+	assert := assert.New(t)
+	t.Parallel()
+
+	for _, c := range []struct {
+		name          string
+		parseStr      string
+		expectedValue *vault.SecretSpec
+		expectedErr   error
+	}{
+		{
+			name:          "parse-generic",
+			parseStr:      "kv/storage/postgres/creds#password",
+			expectedValue: &vault.SecretSpec{Path: "kv/storage/postgres/creds", Field: "password"},
+		},
+		{
+			name:     "parse-transforms",
+			parseStr: "kv/storage/postgres/creds#username|base64d| trim|upper",
+			expectedValue: &vault.SecretSpec{
+				Path:            "kv/storage/postgres/creds",
+				Field:           "username",
+				Transformations: []string{"base64d", "trim", "upper"},
+			},
+		},
+		{
+			name:          "parse-meta",
+			parseStr:      "kv/storage/postgres/creds#meta:custom.owner",
+			expectedValue: &vault.SecretSpec{Path: "kv/storage/postgres/creds", Meta: "custom.owner"},
+		},
+		{
+			name:        "parse-missing-field-separator",
+			parseStr:    "kv/storage/postgres/creds",
+			expectedErr: errors.New("unable to parse spec: kv/storage/postgres/creds (expected path#field)"),
+		},
+		{
+			name:        "parse-empty-field",
+			parseStr:    "kv/storage/postgres/creds#|trim",
+			expectedErr: errors.New("field may not be empty"),
+		},
+		{
+			name:        "parse-empty-path",
+			parseStr:    "#password",
+			expectedErr: errors.New("path may not be empty"),
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			spec, err := vault.ParseEnvsubstSpec(c.parseStr)
+			assert.Equal(c.expectedErr, err)
+			assert.Equal(c.expectedValue, spec)
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package vault
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+)
+
+// minRenewWindow is the minimum remaining lifetime below which a token is
+// considered due for renewal.
+const minRenewWindow = 10 * time.Second
+
+// AuthError is returned when a vault token could not be obtained, renewed or
+// was rejected by vault.
+type AuthError struct{ Err error }
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("vault authentication failed: %s", e.Err)
+}
+
+func (e *AuthError) Unwrap() error { return e.Err }
+
+// tokenManager keeps a client's token valid for the duration of a run. Tokens
+// are renewed ahead of expiry, once renewal is no longer possible a new token
+// is requested using the configured auth method, if any.
+type tokenManager struct {
+	client *api.Client
+	auth   AuthMethod
+
+	mu sync.Mutex
+	// known indicates whether the remaining fields have been populated, either
+	// by a login or a token lookup.
+	known     bool
+	renewable bool
+	// ttl is the token's TTL at creation, used to determine when it is due for
+	// renewal.
+	ttl time.Duration
+	// expiry is zero for tokens which do not expire.
+	expiry time.Time
+}
+
+// login obtains a new token using the configured auth method. The login is
+// performed on a copy of the client so that requests in flight keep using the
+// current token until the new one is set.
+func (t *tokenManager) login() error {
+	c, err := t.client.CloneWithHeaders()
+	if err != nil {
+		return &AuthError{err}
+	}
+	// Login endpoints do not require a token, make sure a stale one is not sent
+	// along.
+	c.ClearToken()
+	secret, err := t.auth.Login(c)
+	if err != nil {
+		return &AuthError{err}
+	}
+	t.client.SetToken(secret.Auth.ClientToken)
+	if err := t.update(secret); err != nil {
+		return err
+	}
+	t.ttl = time.Until(t.expiry)
+	return nil
+}
+
+// lookup populates the token's lifetime information from vault.
+func (t *tokenManager) lookup() error {
+	secret, err := t.client.Auth().Token().LookupSelf()
+	if err != nil {
+		return err
+	}
+	if err := t.update(secret); err != nil {
+		return err
+	}
+	// Lookups report the remaining TTL, the creation TTL is reported
+	// separately.
+	t.ttl = time.Until(t.expiry)
+	if n, ok := secret.Data["creation_ttl"].(json.Number); ok {
+		if v, err := n.Int64(); err == nil {
+			t.ttl = time.Duration(v) * time.Second
+		}
+	}
+	return nil
+}
+
+// renew extends the token's lifetime. The token's creation TTL is left
+// unchanged.
+func (t *tokenManager) renew() error {
+	secret, err := t.client.Auth().Token().RenewSelf(0)
+	if err != nil {
+		return err
+	}
+	return t.update(secret)
+}
+
+func (t *tokenManager) update(secret *api.Secret) error {
+	ttl, err := secret.TokenTTL()
+	if err != nil {
+		return &AuthError{fmt.Errorf("token: %w", err)}
+	}
+	renewable, err := secret.TokenIsRenewable()
+	if err != nil {
+		return &AuthError{fmt.Errorf("token: %w", err)}
+	}
+	t.known = true
+	t.renewable = renewable
+	t.expiry = time.Time{}
+	if ttl > 0 {
+		t.expiry = time.Now().Add(ttl)
+	}
+	return nil
+}
+
+// window returns the remaining token lifetime below which the token should be
+// renewed. The window never exceeds half of the token's TTL so that freshly
+// issued short-lived tokens are not immediately considered due.
+func (t *tokenManager) window() time.Duration {
+	return min(max(t.ttl/3, minRenewWindow), t.ttl/2)
+}
+
+// ensure makes sure the client holds a token which is valid for at least the
+// renewal window, renewing the current token or logging in again as needed.
+func (t *tokenManager) ensure() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.known {
+		if err := t.lookup(); err != nil {
+			if !isPermissionDenied(err) {
+				return err
+			}
+			return t.relogin(err)
+		}
+	}
+	if t.expiry.IsZero() || time.Until(t.expiry) > t.window() {
+		return nil
+	}
+	var err error
+	if t.renewable {
+		if err = t.renew(); err == nil && time.Until(t.expiry) > t.window() {
+			return nil
+		}
+		// A failed renewal or one which does not extend the token past the
+		// renewal window means it has reached its max TTL, there is no point in
+		// trying again.
+		t.renewable = false
+	}
+	if t.auth == nil && time.Until(t.expiry) > 0 {
+		// Nothing more we can do, but the token is still valid for now.
+		return nil
+	}
+	if err == nil {
+		err = errors.New("token expired and cannot be renewed")
+	}
+	return t.relogin(err)
+}
+
+// relogin logs in again after the current token has failed with err. If no
+// auth method is configured, err is returned as an AuthError instead.
+func (t *tokenManager) relogin(err error) error {
+	if t.auth == nil {
+		return &AuthError{fmt.Errorf("token: %w", err)}
+	}
+	return t.login()
+}
+
+// handleDenied is called after a request sent with token failed with err. If
+// err is a permission error caused by the token no longer being valid, a new
+// one is requested and true is returned to indicate that the request should be
+// retried. If the token has already been replaced by a concurrent request in
+// the meantime, the request is retried right away. Otherwise err is returned
+// unchanged.
+func (t *tokenManager) handleDenied(token string, err error) (bool, error) {
+	if !isPermissionDenied(err) {
+		return false, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.client.Token() != token {
+		return true, nil
+	}
+	if lookupErr := t.lookup(); lookupErr == nil || !isPermissionDenied(lookupErr) {
+		return false, err
+	}
+	if err := t.relogin(errors.New("token was rejected by vault")); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func isPermissionDenied(err error) bool {
+	var respErr *api.ResponseError
+	return errors.As(err, &respErr) && respErr.StatusCode == http.StatusForbidden
+}
@@ -0,0 +1,303 @@
+package vault_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/vault"
+)
+
+func TestTokenLifecycle(t *testing.T) {
+	assert := assert.New(t)
+	spec := &vault.SecretSpec{Path: "kv/app", Field: "password", MountVersion: vault.KVv2}
+
+	for _, c := range []struct {
+		name string
+		// ttl is the creation TTL of issued tokens in seconds, remaining the TTL
+		// reported by token lookups (defaults to ttl) and renewTTL the TTL
+		// granted on renewal. Renewals fail if renewTTL is zero.
+		ttl, remaining, renewTTL int
+		auth                     vault.AuthMethod
+		token                    string
+		// prepare is called after the client has been constructed.
+		prepare          func(v *fakeVault)
+		spec             *vault.SecretSpec
+		expectedErr      string
+		expectedAuthErr  bool
+		expectedLogins   int
+		expectedRenewals int
+	}{
+		{
+			name:  "token-long-ttl",
+			ttl:   3600,
+			token: "root",
+		},
+		{
+			name:             "token-renewed-before-expiry",
+			ttl:              3600,
+			remaining:        5,
+			renewTTL:         3600,
+			token:            "root",
+			expectedRenewals: 1,
+		},
+		{
+			name:             "token-max-ttl-reached",
+			ttl:              3600,
+			remaining:        5,
+			renewTTL:         5,
+			token:            "root",
+			expectedRenewals: 1,
+		},
+		{
+			name:            "token-invalid",
+			ttl:             3600,
+			token:           "invalid",
+			expectedErr:     "vault authentication failed: token: ",
+			expectedAuthErr: true,
+		},
+		{
+			name: "approle-relogin-when-renewal-fails",
+			ttl:  1,
+			auth: &vault.AppRoleAuth{RoleID: "role", SecretID: "secret"},
+			// Wait until the token is due for renewal.
+			prepare:          func(*fakeVault) { time.Sleep(600 * time.Millisecond) },
+			expectedLogins:   2,
+			expectedRenewals: 1,
+		},
+		{
+			name:           "approle-relogin-after-revocation",
+			ttl:            3600,
+			auth:           &vault.AppRoleAuth{RoleID: "role", SecretID: "secret"},
+			prepare:        func(v *fakeVault) { v.revokeAll() },
+			expectedLogins: 2,
+		},
+		{
+			name:            "approle-relogin-fails",
+			ttl:             3600,
+			auth:            &vault.AppRoleAuth{RoleID: "role", SecretID: "secret"},
+			prepare:         func(v *fakeVault) { v.revokeAll(); v.disableLogin = true },
+			expectedErr:     "vault authentication failed: approle: login failed",
+			expectedAuthErr: true,
+			expectedLogins:  1,
+		},
+		{
+			name:           "permission-denied-by-policy",
+			ttl:            3600,
+			auth:           &vault.AppRoleAuth{RoleID: "role", SecretID: "secret"},
+			spec:           &vault.SecretSpec{Path: "kv/forbidden", Field: "password", MountVersion: vault.KVv2},
+			expectedErr:    "permission denied",
+			expectedLogins: 1,
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			v := newFakeVault(t, c.ttl)
+			v.remaining, v.renewTTL = c.remaining, c.renewTTL
+			if c.token != "" {
+				t.Setenv("VAULT_TOKEN", c.token)
+			}
+			client, err := vault.NewClient(c.auth, "")
+			assert.Nil(err)
+			if c.prepare != nil {
+				c.prepare(v)
+			}
+			s := spec
+			if c.spec != nil {
+				s = c.spec
+			}
+			secret, err := client.ReadKV(s)
+			if c.expectedErr != "" {
+				assert.ErrorContains(err, c.expectedErr)
+				var authErr *vault.AuthError
+				assert.Equal(c.expectedAuthErr, errors.As(err, &authErr))
+			} else {
+				assert.Nil(err)
+				assert.Equal("hunter2", secret.Data["password"])
+			}
+			assert.Equal(c.expectedLogins, v.logins)
+			assert.Equal(c.expectedRenewals, v.renewals)
+		})
+	}
+}
+
+func TestTokenReloginConcurrent(t *testing.T) {
+	assert := assert.New(t)
+	v := newFakeVault(t, 3600)
+	client, err := vault.NewClient(&vault.AppRoleAuth{RoleID: "role", SecretID: "secret"}, "")
+	assert.Nil(err)
+	v.revokeAll()
+
+	// Mounts are given explicitly so that reads are not serialized by mount
+	// lookups and all of them are sent using the revoked token.
+	var wg sync.WaitGroup
+	errs := make([]error, 64)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = client.ReadKV(&vault.SecretSpec{Path: fmt.Sprintf("kv/app-%d", i), Field: "password", Mount: "kv", MountVersion: vault.KVv2})
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		assert.Nil(err)
+	}
+	assert.Equal(2, v.logins)
+}
+
+// fakeVault emulates the subset of vault's API required for token
+// management, mount lookups and KV reads. The token "root" is always valid,
+// further tokens are issued by approle logins with role ID "role" and secret
+// ID "secret". KV reads return the data of a fixed secret, along with the
+// mount, path and namespace it was read from. Any version of the secret may be
+// read except for version 2, which has been deleted.
+type fakeVault struct {
+	mu           sync.Mutex
+	ttl          int
+	remaining    int
+	renewTTL     int
+	tokens       map[string]bool
+	disableLogin bool
+	// mounts maps mount paths to their KV version.
+	mounts map[string]string
+
+	logins       int
+	renewals     int
+	mountLookups int
+}
+
+func newFakeVault(t *testing.T, ttl int) *fakeVault {
+	t.Helper()
+	v := &fakeVault{
+		ttl:    ttl,
+		tokens: map[string]bool{"root": true},
+		mounts: map[string]string{"kv": "2"},
+	}
+	srv := httptest.NewServer(v)
+	t.Cleanup(srv.Close)
+	t.Setenv("VAULT_ADDR", srv.URL)
+	return v
+}
+
+func (v *fakeVault) revokeAll() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.tokens = map[string]bool{}
+}
+
+// mount returns the longest mount path which is a prefix of path, along with
+// the remainder of path.
+func (v *fakeVault) mount(path string) (string, string) {
+	var mount string
+	for m := range v.mounts {
+		if len(m) > len(mount) && (path == m || strings.HasPrefix(path, m+"/")) {
+			mount = m
+		}
+	}
+	return mount, strings.TrimPrefix(strings.TrimPrefix(path, mount), "/")
+}
+
+func (v *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil || v.disableLogin || body["role_id"] != "role" || body["secret_id"] != "secret" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"invalid credentials"}})
+			return
+		}
+		v.logins++
+		token := fmt.Sprintf("token-%d", v.logins)
+		v.tokens[token] = true
+		writeJSON(w, http.StatusOK, &api.Secret{Auth: &api.SecretAuth{ClientToken: token, LeaseDuration: v.ttl, Renewable: true}})
+		return
+	}
+
+	token := r.Header.Get("X-Vault-Token")
+	if !v.tokens[token] {
+		writeJSON(w, http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+	switch {
+	case path == "auth/token/lookup-self":
+		remaining := v.remaining
+		if remaining == 0 {
+			remaining = v.ttl
+		}
+		writeJSON(w, http.StatusOK, &api.Secret{Data: map[string]any{"ttl": remaining, "creation_ttl": v.ttl, "renewable": true}})
+	case path == "auth/token/renew-self":
+		v.renewals++
+		if v.renewTTL == 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"lease is not renewable"}})
+			return
+		}
+		writeJSON(w, http.StatusOK, &api.Secret{Auth: &api.SecretAuth{ClientToken: token, LeaseDuration: v.renewTTL, Renewable: true}})
+	case strings.HasPrefix(path, "sys/internal/ui/mounts/"):
+		v.mountLookups++
+		mount, _ := v.mount(strings.TrimPrefix(path, "sys/internal/ui/mounts/"))
+		if mount == "" {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"no mount found"}})
+			return
+		}
+		writeJSON(w, http.StatusOK, &api.Secret{Data: map[string]any{
+			"path":    mount + "/",
+			"type":    "kv",
+			"options": map[string]any{"version": strings.TrimPrefix(v.mounts[mount], "v")},
+		}})
+	default:
+		mount, rest := v.mount(path)
+		if mount == "" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if rest == "forbidden" || rest == "data/forbidden" {
+			writeJSON(w, http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+			return
+		}
+		data := map[string]any{
+			"password":  "hunter2",
+			"namespace": r.Header.Get("X-Vault-Namespace"),
+			"mount":     mount,
+			"path":      rest,
+		}
+		if v.mounts[mount] == "1" {
+			writeJSON(w, http.StatusOK, &api.Secret{Data: data})
+			return
+		}
+		data["path"] = strings.TrimPrefix(rest, "data/")
+		// Version 2 of every secret has been deleted, vault responds with the
+		// version's metadata only.
+		version := r.URL.Query().Get("version")
+		if version == "2" {
+			writeJSON(w, http.StatusNotFound, &api.Secret{Data: map[string]any{
+				"data":     nil,
+				"metadata": map[string]any{"version": 2, "created_time": "2024-01-01T00:00:00Z", "deletion_time": "2024-02-01T00:00:00Z", "destroyed": false},
+			}})
+			return
+		}
+		if version == "" {
+			version = "1"
+		}
+		writeJSON(w, http.StatusOK, &api.Secret{Data: map[string]any{
+			"data":     data,
+			"metadata": map[string]any{"version": json.Number(version), "created_time": "2024-01-01T00:00:00Z", "deletion_time": "", "destroyed": false},
+		}})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/toalaah/vaultsubst/internal/substitute"
+	"github.com/toalaah/vaultsubst/internal/vault"
+	"github.com/urfave/cli/v3"
+)
+
+var listCmd = &cli.Command{
+	Name:      "list",
+	Usage:     "list the secrets referenced by templates",
+	ArgsUsage: "FILE [FILE...]",
+	Action:    runListCmd,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "format",
+			Aliases: []string{"f"},
+			Value:   "text",
+			Usage:   "output format (text, json, csv or policy)",
+		},
+		&cli.BoolFlag{
+			Name:  "online",
+			Value: false,
+			Usage: "look up mounts and their KV versions in vault instead of assuming them from the secret paths",
+		},
+	},
+}
+
+// listEntry is a single secret reference as printed by the list command.
+type listEntry struct {
+	File            string   `json:"file"`
+	Line            int      `json:"line"`
+	Col             int      `json:"col"`
+	Namespace       string   `json:"namespace,omitempty"`
+	Path            string   `json:"path"`
+	Mount           string   `json:"mount"`
+	KVVersion       string   `json:"kv_version"`
+	Field           string   `json:"field,omitempty"`
+	Meta            string   `json:"meta,omitempty"`
+	Version         int      `json:"version,omitempty"`
+	Transformations []string `json:"transformations,omitempty"`
+
+	spec *vault.SecretSpec
+	loc  *vault.Location
+}
+
+// runListCmd prints the secrets referenced by the given files. Unless --online
+// is set, vault is not contacted and mounts and their KV versions are
+// determined from the specs alone. References which cannot be parsed are
+// reported as errors once all valid ones have been printed.
+func runListCmd(ctx context.Context, cmd *cli.Command) error {
+	args, err := parseArgs(cmd)
+	if err != nil {
+		return err
+	}
+	if args == nil {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+
+	var write func(io.Writer, []*listEntry) error
+	switch f := cmd.String("format"); f {
+	case "text":
+		write = writeText
+	case "json":
+		write = writeJSON
+	case "csv":
+		write = writeCSV
+	case "policy":
+		write = func(w io.Writer, entries []*listEntry) error {
+			return writePolicy(w, entries, cmd.String("namespace"), 0)
+		}
+	default:
+		return fmt.Errorf("unknown format: %s", f)
+	}
+
+	files, err := collectFiles(args)
+	if err != nil {
+		return err
+	}
+	c, err := locateClient(cmd)
+	if err != nil {
+		return err
+	}
+	entries, listErr := listEntries(files, c)
+	if err := write(os.Stdout, entries); err != nil {
+		return err
+	}
+	return listErr
+}
+
+// locateClient returns the client used to locate secrets. Unless --online is
+// set, the client does not contact vault.
+func locateClient(cmd *cli.Command) (*vault.Client, error) {
+	if cmd.Bool("online") {
+		return newClient(cmd)
+	}
+	return &vault.Client{Namespace: cmd.String("namespace")}, nil
+}
+
+// listEntries returns the secret references in files, located using client. A
+// warning is printed for each reference whose mount or KV version had to be
+// assumed.
+func listEntries(files []string, client *vault.Client) ([]*listEntry, error) {
+	var (
+		entries []*listEntry
+		errs    []error
+	)
+	for _, file := range files {
+		refs, err := findReferences(file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, ref := range refs {
+			var loc *vault.Location
+			if ref.Err == nil {
+				loc, ref.Err = client.Locate(ref.Secret)
+			}
+			if ref.Err != nil {
+				errs = append(errs, &substitute.Error{File: ref.File, Line: ref.Line, Col: ref.Col, Spec: ref.Spec, Err: ref.Err})
+				continue
+			}
+			if loc.Guessed {
+				fmt.Fprintf(os.Stderr, "warning: %s:%d:%d: assuming mount %s with kv version %s for %s, set mount= and ver= or use --online\n",
+					ref.File, ref.Line, ref.Col, loc.Mount, loc.KVVersion, ref.Secret.Path)
+			}
+			entries = append(entries, &listEntry{
+				File:            ref.File,
+				Line:            ref.Line,
+				Col:             ref.Col,
+				Namespace:       loc.Namespace,
+				Path:            ref.Secret.Path,
+				Mount:           loc.Mount,
+				KVVersion:       loc.KVVersion,
+				Field:           ref.Secret.Field,
+				Meta:            ref.Secret.Meta,
+				Version:         ref.Secret.Version,
+				Transformations: ref.Secret.Transformations,
+				spec:            ref.Secret,
+				loc:             loc,
+			})
+		}
+	}
+	return entries, errors.Join(errs...)
+}
+
+func findReferences(file string) ([]*substitute.Reference, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return substitute.Find(f, r, substitute.WithFilename(file), substitute.WithParser(parser), substitute.WithStrict(strict))
+}
+
+func writeText(w io.Writer, entries []*listEntry) error {
+	for _, e := range entries {
+		s := e.spec.String()
+		if e.Namespace != "" {
+			s += " (namespace " + e.Namespace + ")"
+		}
+		if _, err := fmt.Fprintf(w, "%s:%d:%d: %s\n", e.File, e.Line, e.Col, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, entries []*listEntry) error {
+	if entries == nil {
+		entries = []*listEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(entries)
+}
+
+func writeCSV(w io.Writer, entries []*listEntry) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"file", "line", "col", "namespace", "path", "mount", "kv_version", "field", "meta", "version", "transformations"})
+	for _, e := range entries {
+		version := ""
+		if e.Version != 0 {
+			version = strconv.Itoa(e.Version)
+		}
+		_ = cw.Write([]string{
+			e.File, strconv.Itoa(e.Line), strconv.Itoa(e.Col), e.Namespace, e.Path, e.Mount,
+			e.KVVersion, e.Field, e.Meta, version, strings.Join(e.Transformations, "|"),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -1,14 +1,19 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"regexp"
+	"runtime"
 	"runtime/debug"
 	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/toalaah/vaultsubst/internal/path"
 	"github.com/toalaah/vaultsubst/internal/substitute"
@@ -23,16 +28,41 @@ var (
 
 	app *cli.Command
 
-	client    *vault.Client
-	r         *regexp.Regexp
-	inPlace   bool
-	recursive bool
+	client      *vault.Client
+	r           *regexp.Regexp
+	inPlace     bool
+	parser      substitute.Parser
+	strict      bool
+	walker      *path.Walker
+	concurrency int
+	jobs        int
+	redactor    substitute.Redactor
+	// mode is set on files which received secrets, zero to preserve their mode.
+	mode fs.FileMode
+	// outputDir is the directory files are rendered to, empty if rendering to
+	// stdout or in place.
+	outputDir   string
+	stripSuffix string
+	outputsMu   sync.Mutex
+	// outputs maps the paths rendered to in output directory mode to the
+	// files rendered to them.
+	outputs map[string]string
+	// process handles a single file which is written to out in output
+	// directory mode, returning the output to print to stdout if any.
+	process = patchFile
 )
 
 func main() {
 	if err := app.Run(context.Background(), os.Args); err != nil {
-		fmt.Fprintf(os.Stderr, "error: %s\n", err)
-		os.Exit(1)
+		if msg := err.Error(); msg != "" {
+			fmt.Fprintf(os.Stderr, "error: %s\n", msg)
+		}
+		code := 1
+		var exitErr cli.ExitCoder
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		}
+		os.Exit(code)
 	}
 }
 
@@ -44,6 +74,9 @@ func init() {
 		Action:          runCmd,
 		Version:         buildVersionString(),
 		HideHelpCommand: true,
+		// Errors are reported by main.
+		ExitErrHandler: func(context.Context, *cli.Command, error) {},
+		Commands:       []*cli.Command{checkCmd, listCmd, policyCmd},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
 				Name:    "delimiter",
@@ -51,68 +84,355 @@ func init() {
 				Value:   "@@",
 				Usage:   "delimiter to use for injections",
 			},
+			&cli.StringFlag{
+				Name:  "syntax",
+				Value: "default",
+				Usage: "reference syntax, either default (@@path=...,field=...@@) or envsubst (${vault:path#field|transform})",
+			},
+			&cli.StringFlag{
+				Name:  "open",
+				Usage: "opening delimiter to use for injections, overrides --delimiter",
+			},
+			&cli.StringFlag{
+				Name:  "close",
+				Usage: "closing delimiter to use for injections, overrides --delimiter",
+			},
+			&cli.BoolFlag{
+				Name:  "strict",
+				Value: true,
+				Usage: "fail on text between delimiters which is not a valid reference, if false such text is left untouched",
+			},
 			&cli.BoolFlag{
 				Name:    "in-place",
 				Aliases: []string{"i"},
 				Value:   false,
 				Usage:   "modify files in place",
 			},
+			&cli.StringFlag{
+				Name:      "output-dir",
+				TakesFile: true,
+				Usage:     "render files to the same relative paths below `DIR` instead of stdout",
+			},
+			&cli.StringFlag{
+				Name:  "strip-suffix",
+				Usage: "strip `SUFFIX` such as .tpl from the names of files rendered to the output directory",
+			},
+			&cli.StringFlag{
+				Name:  "mode",
+				Usage: "set the octal `MODE` of written files which received secrets, such as 0600",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Value: false,
+				Usage: "resolve secrets as usual, but print placeholders instead of their values without modifying any files",
+			},
+			&cli.BoolFlag{
+				Name:  "mask",
+				Value: false,
+				Usage: "in dry-run mode, mask values with asterisks of the same length instead of using placeholders",
+			},
+			&cli.BoolFlag{
+				Name:  "diff",
+				Value: false,
+				Usage: "print a unified diff of the changes to each file instead of its output, exits with 1 if any file would change",
+			},
+			&cli.BoolFlag{
+				Name:  "show-secrets",
+				Value: false,
+				Usage: "show secret values in clear in diffs rather than masking them",
+			},
 			&cli.BoolFlag{
 				Name:    "recursive",
 				Aliases: []string{"r"},
 				Value:   false,
 				Usage:   "recurse subdirectories",
 			},
+			&cli.StringSliceFlag{
+				Name:  "include",
+				Usage: "only process files matching `GLOB` in directory mode, may be repeated",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "skip files and directories matching `GLOB` in directory mode, may be repeated",
+			},
+			&cli.BoolFlag{
+				Name:  "gitignore",
+				Value: false,
+				Usage: "skip files ignored by .gitignore files and .git directories in directory mode",
+			},
+			&cli.BoolFlag{
+				Name:  "follow-symlinks",
+				Value: false,
+				Usage: "descend into symlinked directories in recursive mode",
+			},
+			&cli.BoolFlag{
+				Name:  "verbose",
+				Value: false,
+				Usage: "log skipped files",
+			},
+			&cli.IntFlag{
+				Name:    "jobs",
+				Aliases: []string{"j"},
+				Value:   runtime.NumCPU(),
+				Usage:   "maximum number of files to process in parallel in directory mode",
+			},
+			&cli.IntFlag{
+				Name:  "concurrency",
+				Value: 4,
+				Usage: "maximum number of secrets to fetch concurrently per file",
+			},
+			&cli.StringFlag{
+				Name:    "namespace",
+				Aliases: []string{"ns"},
+				Sources: cli.EnvVars("VAULT_NAMESPACE"),
+				Usage:   "default vault namespace to log in to and read secrets from",
+			},
+			&cli.StringFlag{
+				Name:    "auth-method",
+				Sources: cli.EnvVars("VAULT_AUTH_METHOD"),
+				Value:   "token",
+				Usage:   "method to authenticate with (token, approle, kubernetes or jwt)",
+			},
+			&cli.StringFlag{
+				Name:    "auth-mount",
+				Sources: cli.EnvVars("VAULT_AUTH_MOUNT"),
+				Usage:   "mount path of the auth method, defaults to the method's name",
+			},
+			&cli.StringFlag{
+				Name:    "auth-role",
+				Sources: cli.EnvVars("VAULT_AUTH_ROLE"),
+				Usage:   "role to log in as using kubernetes or jwt auth",
+			},
+			&cli.StringFlag{
+				Name:      "kubernetes-token-file",
+				Sources:   cli.EnvVars("VAULT_KUBERNETES_TOKEN_FILE"),
+				Value:     vault.DefaultKubernetesTokenFile,
+				TakesFile: true,
+				Usage:     "read kubernetes service account token from `FILE`",
+			},
+			&cli.StringFlag{
+				Name:    "jwt",
+				Sources: cli.EnvVars("VAULT_JWT"),
+				Usage:   "jwt to log in with using jwt auth",
+			},
+			&cli.StringFlag{
+				Name:      "jwt-file",
+				Sources:   cli.EnvVars("VAULT_JWT_FILE"),
+				TakesFile: true,
+				Usage:     "read jwt from `FILE`",
+			},
+			&cli.StringFlag{
+				Name:    "role-id",
+				Sources: cli.EnvVars("VAULT_ROLE_ID"),
+				Usage:   "approle role_id to log in with",
+			},
+			&cli.StringFlag{
+				Name:      "role-id-file",
+				Sources:   cli.EnvVars("VAULT_ROLE_ID_FILE"),
+				TakesFile: true,
+				Usage:     "read approle role_id from `FILE`",
+			},
+			&cli.StringFlag{
+				Name:    "secret-id",
+				Sources: cli.EnvVars("VAULT_SECRET_ID"),
+				Usage:   "approle secret_id to log in with",
+			},
+			&cli.StringFlag{
+				Name:      "secret-id-file",
+				Sources:   cli.EnvVars("VAULT_SECRET_ID_FILE"),
+				TakesFile: true,
+				Usage:     "read approle secret_id from `FILE`",
+			},
 		},
 	}
 }
 
 func runCmd(ctx context.Context, cmd *cli.Command) error {
-	var err error
-
-	escapedDelim := regexp.QuoteMeta(cmd.String("delimiter"))
-	r = regexp.MustCompile(fmt.Sprintf(`%s(.*?)%s`, escapedDelim, escapedDelim))
-	args := cmd.Args().Slice()
-	inPlace = cmd.Bool("in-place")
-	recursive = cmd.Bool("recursive")
-
-	if len(args) == 0 {
-		// Fallback to stdin if no arguments were passed.
-		has, err := hasStdin()
-		if err != nil {
-			return err
-		}
-		if has {
-			if inPlace {
-				fmt.Fprintf(os.Stderr, "ignoring in-place flag\n")
-				inPlace = false
-			}
-			args = append(args, "/dev/stdin")
-		} else {
-			return cli.ShowAppHelp(cmd)
-		}
+	args, err := parseArgs(cmd)
+	if err != nil {
+		return err
+	}
+	if args == nil {
+		return cli.ShowAppHelp(cmd)
+	}
+	if args[0] == "/dev/stdin" && inPlace {
+		fmt.Fprintf(os.Stderr, "ignoring in-place flag\n")
+		inPlace = false
+	}
+	outputDir = cmd.String("output-dir")
+	stripSuffix = cmd.String("strip-suffix")
+	switch {
+	case outputDir != "" && inPlace:
+		return errors.New("--output-dir and --in-place may not be used together")
+	case outputDir != "" && args[0] == "/dev/stdin":
+		return errors.New("--output-dir may not be used with stdin")
 	}
+	switch {
+	case cmd.Bool("mask") && !cmd.Bool("dry-run"):
+		return errors.New("--mask requires --dry-run")
+	case cmd.Bool("mask"):
+		redactor = substitute.RedactMask
+	case cmd.Bool("dry-run"):
+		redactor = substitute.RedactPlaceholder
+	}
+	if redactor != nil {
+		// Dry runs never modify files, print the result instead.
+		inPlace = false
+		outputDir = ""
+	}
+	diff := cmd.Bool("diff")
+	if diff {
+		process = diffFile
+		inPlace = false
+		// Values are already redacted in dry-run mode.
+		maskDiffs = redactor == nil && !cmd.Bool("show-secrets")
+	}
+	// Never write through symlinks to files outside of the processed
+	// directories.
+	walker.Confined = inPlace
+	walker.OutputDir = outputDir
 
-	client, err = vault.NewClient()
+	client, err = newClient(cmd)
 	if err != nil {
+		if diff {
+			return diffResult([]error{err})
+		}
 		return err
 	}
 
+	// Keep going on errors such that all of them can be reported at once.
+	var errs []error
 	for _, pth := range args {
 		handler := handleFile
 		isDir, err := path.IsDir(pth)
 		if err != nil {
-			return err
+			errs = append(errs, err)
+			continue
 		}
 		if isDir {
 			handler = handleDir
 		}
 		if err := handler(pth); err != nil {
-			return err
+			errs = append(errs, err)
 		}
 	}
 
-	return nil
+	if diff {
+		return diffResult(errs)
+	}
+	return errors.Join(errs...)
+}
+
+// parseArgs applies the flags shared by all commands and returns the files
+// and directories to process. If no arguments were passed, stdin is used if
+// it is not a terminal, otherwise nil is returned.
+func parseArgs(cmd *cli.Command) ([]string, error) {
+	openDelim, closeDelim := cmd.String("delimiter"), cmd.String("delimiter")
+	if cmd.IsSet("open") || cmd.IsSet("close") {
+		openDelim, closeDelim = cmd.String("open"), cmd.String("close")
+		if openDelim == "" || closeDelim == "" {
+			return nil, errors.New("--open and --close must be set together")
+		}
+	}
+	switch s := cmd.String("syntax"); s {
+	case "default":
+		parser = vault.NewSecretSpec
+	case "envsubst":
+		if cmd.IsSet("delimiter") || cmd.IsSet("open") || cmd.IsSet("close") {
+			return nil, errors.New("--syntax=envsubst may not be used with --delimiter, --open or --close")
+		}
+		openDelim, closeDelim = substitute.EnvsubstOpen, substitute.EnvsubstClose
+		parser = vault.ParseEnvsubstSpec
+	default:
+		return nil, fmt.Errorf("unknown syntax: %s", s)
+	}
+	var err error
+	r, err = substitute.NewRegexp(openDelim, closeDelim)
+	if err != nil {
+		return nil, err
+	}
+	strict = cmd.Bool("strict")
+	inPlace = cmd.Bool("in-place")
+	walker = &path.Walker{
+		Recursive:      cmd.Bool("recursive"),
+		Include:        cmd.StringSlice("include"),
+		Exclude:        cmd.StringSlice("exclude"),
+		GitIgnore:      cmd.Bool("gitignore"),
+		FollowSymlinks: cmd.Bool("follow-symlinks"),
+	}
+	if cmd.Bool("verbose") {
+		walker.Skipped = func(path, reason string) {
+			fmt.Fprintf(os.Stderr, "skipping %s: %s\n", path, reason)
+		}
+	}
+	concurrency = cmd.Int("concurrency")
+	if concurrency < 1 {
+		return nil, fmt.Errorf("concurrency must be at least 1, got %d", concurrency)
+	}
+	jobs = cmd.Int("jobs")
+	if jobs < 1 {
+		return nil, fmt.Errorf("jobs must be at least 1, got %d", jobs)
+	}
+	mode = 0
+	if s := cmd.String("mode"); s != "" {
+		m, err := strconv.ParseUint(s, 8, 32)
+		if err != nil || m == 0 || m > 0o777 {
+			return nil, fmt.Errorf("invalid mode: %s", s)
+		}
+		mode = fs.FileMode(m)
+	}
+
+	args := cmd.Args().Slice()
+	if len(args) > 0 {
+		return args, nil
+	}
+	// Fallback to stdin if no arguments were passed.
+	has, err := hasStdin()
+	if err != nil || !has {
+		return nil, err
+	}
+	return []string{"/dev/stdin"}, nil
+}
+
+// newClient returns a vault client configured via cmd's flags.
+func newClient(cmd *cli.Command) (*vault.Client, error) {
+	auth, err := authMethod(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return vault.NewClient(auth, cmd.String("namespace"))
+}
+
+// authMethod returns the auth method selected via cmd's flags. A nil method is
+// returned for token authentication, which is handled by the client itself.
+func authMethod(cmd *cli.Command) (vault.AuthMethod, error) {
+	switch m := cmd.String("auth-method"); m {
+	case "token":
+		return nil, nil
+	case "approle":
+		return &vault.AppRoleAuth{
+			Mount:        cmd.String("auth-mount"),
+			RoleID:       cmd.String("role-id"),
+			RoleIDFile:   cmd.String("role-id-file"),
+			SecretID:     cmd.String("secret-id"),
+			SecretIDFile: cmd.String("secret-id-file"),
+		}, nil
+	case "kubernetes":
+		return &vault.KubernetesAuth{
+			Mount:     cmd.String("auth-mount"),
+			Role:      cmd.String("auth-role"),
+			TokenFile: cmd.String("kubernetes-token-file"),
+		}, nil
+	case "jwt":
+		return &vault.JWTAuth{
+			Mount:     cmd.String("auth-mount"),
+			Role:      cmd.String("auth-role"),
+			Token:     cmd.String("jwt"),
+			TokenFile: cmd.String("jwt-file"),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown auth method: %s", m)
+	}
 }
 
 func hasStdin() (bool, error) {
@@ -124,40 +444,176 @@ func hasStdin() (bool, error) {
 }
 
 func handleDir(dir string) error {
-	return filepath.WalkDir(dir, func(path string, f fs.DirEntry, _ error) error {
-		if f.IsDir() {
-			// If we are in recursive mode , we can just return nil here since we
-			// patching a directory makes no sense (we do however need to distinguish
-			// whether we are still in the root directory, as otherwise we skip those
-			// files if '-r' is not set). Otherwise, we explicitly tell the path
-			// walker to skip recursing into this directory, effectively only
-			// iterating the files in the cwd.
-			if recursive || path == dir {
-				return nil
+	files, err := walker.Files(dir)
+	if err != nil {
+		return err
+	}
+	return handleFiles(dir, files)
+}
+
+// handleFiles processes files below root using a pool of workers. Output is
+// written in the order of files regardless of the order in which they are
+// processed. Errors do not stop processing, instead they are returned together
+// once all files have been processed.
+func handleFiles(root string, files []string) error {
+	results := make([]chan fileResult, len(files))
+	for i := range results {
+		results[i] = make(chan fileResult, 1)
+	}
+
+	queue := make(chan int)
+	go func() {
+		defer close(queue)
+		for i := range files {
+			queue <- i
+		}
+	}()
+	for range jobs {
+		go func() {
+			for i := range queue {
+				out, err := outputPath(root, files[i])
+				var b []byte
+				if err == nil {
+					b, err = process(files[i], out)
+				}
+				results[i] <- fileResult{b, err}
 			}
-			return filepath.SkipDir
+		}()
+	}
+
+	var errs []error
+	for _, res := range results {
+		r := <-res
+		if r.err != nil {
+			errs = append(errs, r.err)
+			continue
 		}
-		return handleFile(path)
-	})
+		fmt.Fprint(os.Stdout, string(r.b))
+	}
+	return errors.Join(errs...)
+}
+
+type fileResult struct {
+	b   []byte
+	err error
 }
 
 func handleFile(file string) error {
-	f, err := os.Open(file)
+	out, err := outputPath("", file)
 	if err != nil {
 		return err
 	}
-	b, err := substitute.PatchSecrets(f, r, client)
+	b, err := process(file, out)
 	if err != nil {
 		return err
 	}
-	if inPlace {
-		if err := os.WriteFile(file, b, 0o644); err != nil {
-			return err
+	fmt.Fprint(os.Stdout, string(b))
+	return nil
+}
+
+// outputPath returns the path file is rendered to in output directory mode,
+// empty otherwise. Files below root are rendered to their path relative to
+// root. Files passed as arguments are rendered to their path relative to the
+// working directory if below it, otherwise to their base name. An error is
+// returned if another file is rendered to the same path.
+func outputPath(root, file string) (string, error) {
+	if outputDir == "" {
+		return "", nil
+	}
+	if root == "" {
+		root = "."
+		if filepath.IsAbs(file) {
+			wd, err := os.Getwd()
+			if err != nil {
+				return "", err
+			}
+			root = wd
 		}
-	} else {
-		fmt.Fprint(os.Stdout, string(b))
 	}
-	return nil
+	rel, err := filepath.Rel(root, file)
+	if err != nil || !filepath.IsLocal(rel) {
+		rel = filepath.Base(file)
+	}
+	// Keep files consisting of the suffix only.
+	if len(filepath.Base(rel)) > len(stripSuffix) {
+		rel = strings.TrimSuffix(rel, stripSuffix)
+	}
+	out := filepath.Join(outputDir, rel)
+
+	outputsMu.Lock()
+	defer outputsMu.Unlock()
+	if prev, ok := outputs[out]; ok && prev != file {
+		return "", fmt.Errorf("%s and %s would both be rendered to %s", prev, file, out)
+	}
+	if outputs == nil {
+		outputs = make(map[string]string)
+	}
+	outputs[out] = file
+	return out, nil
+}
+
+// patchFile patches file and returns its patched contents to be printed. In
+// in-place and output directory mode, the patched contents are written to file
+// or out respectively and nothing is returned.
+func patchFile(file, out string) ([]byte, error) {
+	orig, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	b, err := substitute.PatchSecrets(bytes.NewReader(orig), r, client,
+		substitute.WithConcurrency(concurrency),
+		substitute.WithFilename(file),
+		substitute.WithRedactor(redactor),
+		substitute.WithParser(parser),
+		substitute.WithStrict(strict),
+	)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case inPlace:
+		return nil, writeOutput(file, orig, b)
+	case out != "":
+		if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+			return nil, err
+		}
+		return nil, writeRendered(file, out, orig, b)
+	}
+	return b, nil
+}
+
+// writeRendered atomically writes the patched contents b of file with the
+// original contents orig to out. If the file received any secrets, the mode
+// set via --mode is applied, defaulting to the mode of file without any
+// permissions for group and others. Otherwise, the mode of file is copied.
+func writeRendered(file, out string, orig, b []byte) error {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	m := fi.Mode().Perm()
+	if !bytes.Equal(orig, b) {
+		m &^= 0o077
+		switch {
+		case mode != 0:
+			m = mode
+		case m == 0:
+			// A zero mode would preserve the mode of an existing file.
+			m = 0o600
+		}
+	}
+	return path.WriteFileAtomic(out, b, m)
+}
+
+// writeOutput atomically writes the patched contents b of a file with the
+// original contents orig to name. If the file received any secrets, the mode
+// set via --mode is applied.
+func writeOutput(name string, orig, b []byte) error {
+	m := fs.FileMode(0)
+	if !bytes.Equal(orig, b) {
+		m = mode
+	}
+	return path.WriteFileAtomic(name, b, m)
 }
 
 func buildVersionString() string {
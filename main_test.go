@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/assert"
+	"github.com/toalaah/vaultsubst/internal/substitute"
+	"github.com/toalaah/vaultsubst/internal/vault"
+	"github.com/urfave/cli/v3"
+)
+
+// stubReader returns the same secret for every KVv2 read.
+type stubReader struct{}
+
+func (stubReader) ReadKVv1(mount, path string) (*api.KVSecret, error) {
+	return nil, errors.New("not a kv v1 mount")
+}
+
+func (stubReader) ReadKVv2(mount, path string) (*api.KVSecret, error) {
+	return &api.KVSecret{Data: map[string]any{"password": "hunter2", "user": "me"}}, nil
+}
+
+func (stubReader) ReadKVv2Version(mount, path string, version int) (*api.KVSecret, error) {
+	return nil, errors.New("not found")
+}
+
+// setupPatching configures the globals used for patching files with the
+// default syntax and a stub client.
+func setupPatching(t *testing.T) {
+	t.Helper()
+	var err error
+	r, err = substitute.NewRegexp("@@", "@@")
+	assert.Nil(t, err)
+	parser, strict, concurrency = vault.NewSecretSpec, true, 1
+	client = &vault.Client{KVReader: stubReader{}}
+	redactor, mode, stripSuffix, outputDir = nil, 0, "", ""
+	t.Cleanup(func() { changed.Store(0) })
+}
+
+func TestMaskValues(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range []struct {
+		name     string
+		s        string
+		values   []string
+		expected string
+	}{
+		{
+			name:     "longest-first",
+			s:        "pass: hunter2, prefix: hunt",
+			values:   []string{"hunt", "hunter2"},
+			expected: "pass: *******, prefix: ****",
+		},
+		{
+			name:     "short-values-unmasked",
+			s:        "meta=version line 1",
+			values:   []string{"me", "1"},
+			expected: "meta=version line 1",
+		},
+		{
+			name:     "no-values",
+			s:        "unchanged",
+			expected: "unchanged",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(c.expected, maskValues(c.s, c.values))
+		})
+	}
+}
+
+func TestDiffFile(t *testing.T) {
+	assert := assert.New(t)
+	setupPatching(t)
+	dir := t.TempDir()
+	file := filepath.Join(dir, "app.yml")
+	out := filepath.Join(dir, "out.yml")
+	body := "meta=version\nuser: @@path=kv/app,field=user@@\npass: @@path=kv/app,field=password@@\n"
+	assert.Nil(os.WriteFile(file, []byte(body), 0o600))
+
+	for _, c := range []struct {
+		name     string
+		mask     bool
+		out      string
+		existing string
+		expected string
+	}{
+		{
+			name: "template-masked",
+			mask: true,
+			expected: "--- " + file + "\n+++ " + file + "\n@@ -1,3 +1,3 @@\n meta=version\n" +
+				"-user: @@path=kv/app,field=user@@\n-pass: @@path=kv/app,field=password@@\n" +
+				"+user: **\n+pass: *******\n",
+		},
+		{
+			name: "template-shown",
+			expected: "--- " + file + "\n+++ " + file + "\n@@ -1,3 +1,3 @@\n meta=version\n" +
+				"-user: @@path=kv/app,field=user@@\n-pass: @@path=kv/app,field=password@@\n" +
+				"+user: me\n+pass: hunter2\n",
+		},
+		{
+			// Unchanged lines containing secrets are masked as well.
+			name:     "output-dir-masked",
+			mask:     true,
+			out:      out,
+			existing: "meta=version\nuser: me\npass: hunter2 (old)\n",
+			expected: "--- " + out + "\n+++ " + out + "\n@@ -1,3 +1,3 @@\n meta=version\n user: **\n" +
+				"-pass: ******* (old)\n+pass: *******\n",
+		},
+		{
+			name:     "output-dir-unchanged",
+			mask:     true,
+			out:      out,
+			existing: "meta=version\nuser: me\npass: hunter2\n",
+		},
+		{
+			name:     "output-dir-missing-line-break",
+			mask:     true,
+			out:      out,
+			existing: "meta=version\nuser: me\npass: hunter2",
+			expected: "--- " + out + "\n+++ " + out + "\n@@ -1,3 +1,3 @@\n meta=version\n user: **\n" +
+				"-pass: *******\n+pass: *******\n",
+		},
+		{
+			name:     "output-dir-missing",
+			mask:     true,
+			out:      filepath.Join(dir, "missing.yml"),
+			expected: "--- " + filepath.Join(dir, "missing.yml") + "\n+++ " + filepath.Join(dir, "missing.yml") + "\n@@ -0,0 +1,3 @@\n+meta=version\n+user: **\n+pass: *******\n",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			maskDiffs = c.mask
+			if c.existing != "" {
+				assert.Nil(os.WriteFile(c.out, []byte(c.existing), 0o600))
+			}
+			b, err := diffFile(file, c.out)
+			assert.Nil(err)
+			assert.Equal(c.expected, string(b))
+		})
+	}
+}
+
+func TestDiffResult(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, c := range []struct {
+		name         string
+		errs         []error
+		changed      int64
+		expectedCode int
+	}{
+		{name: "unchanged"},
+		{name: "changed", changed: 2, expectedCode: 1},
+		{name: "errors", errs: []error{errors.New("read error")}, changed: 1, expectedCode: 2},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			changed.Store(c.changed)
+			defer changed.Store(0)
+			err := diffResult(c.errs)
+			if c.expectedCode == 0 {
+				assert.Nil(err)
+				return
+			}
+			var exitErr cli.ExitCoder
+			assert.True(errors.As(err, &exitErr))
+			assert.Equal(c.expectedCode, exitErr.ExitCode())
+		})
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	assert := assert.New(t)
+	wd := t.TempDir()
+	t.Chdir(wd)
+	outputDir = "out"
+	t.Cleanup(func() { outputDir, stripSuffix, outputs = "", "", nil })
+
+	for _, c := range []struct {
+		name        string
+		root, file  string
+		stripSuffix string
+		expected    string
+		expectedErr string
+	}{
+		{name: "below-root", root: "tpl", file: "tpl/sub/app.yaml", expected: "out/sub/app.yaml"},
+		{name: "strip-suffix", root: "tpl", file: "tpl/sub/db.yaml.tpl", stripSuffix: ".tpl", expected: "out/sub/db.yaml"},
+		{name: "suffix-only", root: "tpl", file: "tpl/.tpl", stripSuffix: ".tpl", expected: "out/.tpl"},
+		{name: "file-argument", file: "a/app.yaml", expected: "out/a/app.yaml"},
+		{name: "file-argument-again", file: "a/app.yaml", expected: "out/a/app.yaml"},
+		{name: "absolute-file-argument", file: filepath.Join(wd, "b/app.yaml"), expected: "out/b/app.yaml"},
+		{name: "file-argument-outside", file: "../x/app.yaml", expected: "out/app.yaml"},
+		{
+			name:        "conflicting-file-arguments",
+			file:        "../y/app.yaml",
+			expectedErr: "../x/app.yaml and ../y/app.yaml would both be rendered to out/app.yaml",
+		},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			stripSuffix = c.stripSuffix
+			out, err := outputPath(c.root, c.file)
+			if c.expectedErr != "" {
+				assert.EqualError(err, c.expectedErr)
+				return
+			}
+			assert.Nil(err)
+			assert.Equal(c.expected, out)
+		})
+	}
+}
+
+func TestWriteRendered(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+	t.Cleanup(func() { mode = 0 })
+
+	for _, c := range []struct {
+		name         string
+		templateMode os.FileMode
+		mode         os.FileMode
+		secrets      bool
+		expectedMode os.FileMode
+	}{
+		{name: "no-secrets", templateMode: 0o644, expectedMode: 0o644},
+		{name: "secrets", templateMode: 0o644, secrets: true, expectedMode: 0o600},
+		{name: "secrets-executable", templateMode: 0o755, secrets: true, expectedMode: 0o700},
+		{name: "secrets-explicit-mode", templateMode: 0o755, mode: 0o640, secrets: true, expectedMode: 0o640},
+		{name: "no-secrets-explicit-mode", templateMode: 0o755, mode: 0o640, expectedMode: 0o755},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(dir, c.name+".tpl")
+			out := filepath.Join(dir, "out", c.name)
+			orig, b := []byte("template"), []byte("template")
+			if c.secrets {
+				b = []byte("rendered")
+			}
+			assert.Nil(os.WriteFile(file, orig, 0o600))
+			assert.Nil(os.Chmod(file, c.templateMode))
+			assert.Nil(os.MkdirAll(filepath.Dir(out), 0o755))
+			mode = c.mode
+
+			assert.Nil(writeRendered(file, out, orig, b))
+			fi, err := os.Stat(out)
+			assert.Nil(err)
+			assert.Equal(c.expectedMode, fi.Mode().Perm())
+			content, err := os.ReadFile(out)
+			assert.Nil(err)
+			assert.Equal(b, content)
+		})
+	}
+}
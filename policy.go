@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/toalaah/vaultsubst/internal/policy"
+	"github.com/urfave/cli/v3"
+)
+
+var policyCmd = &cli.Command{
+	Name:      "policy",
+	Usage:     "generate a vault policy granting access to the secrets referenced by templates",
+	ArgsUsage: "FILE [FILE...]",
+	Action:    runPolicyCmd,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:      "output",
+			Aliases:   []string{"o"},
+			TakesFile: true,
+			Usage:     "write policy to `FILE` instead of stdout",
+		},
+		&cli.IntFlag{
+			Name:  "glob-depth",
+			Value: 0,
+			Usage: "replace secret path segments beyond `DEPTH` with a glob, 0 disables globs",
+		},
+		&cli.BoolFlag{
+			Name:  "online",
+			Value: false,
+			Usage: "look up mounts and their KV versions in vault instead of assuming them from the secret paths",
+		},
+	},
+}
+
+// runPolicyCmd writes the least-privilege policy required to render the given
+// files. Like list, it does not contact vault unless --online is set. The
+// policy is only written if all references could be parsed.
+func runPolicyCmd(ctx context.Context, cmd *cli.Command) error {
+	args, err := parseArgs(cmd)
+	if err != nil {
+		return err
+	}
+	if args == nil {
+		return cli.ShowSubcommandHelp(cmd)
+	}
+
+	depth := cmd.Int("glob-depth")
+	if depth < 0 {
+		return fmt.Errorf("glob depth must not be negative, got %d", depth)
+	}
+
+	files, err := collectFiles(args)
+	if err != nil {
+		return err
+	}
+	c, err := locateClient(cmd)
+	if err != nil {
+		return err
+	}
+	entries, err := listEntries(files, c)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if out := cmd.String("output"); out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return writePolicy(w, entries, cmd.String("namespace"), depth)
+}
+
+// writePolicy writes the policy granting read access to each entry's data
+// path. Metadata is returned along with a KVv2 secret's data, hence no access
+// to its metadata path is required. The policy is scoped to namespace. Secret
+// paths are generalized to globs beyond depth, if non-zero.
+func writePolicy(w io.Writer, entries []*listEntry, namespace string, depth int) error {
+	p := &policy.Policy{Namespace: namespace}
+	for _, e := range entries {
+		loc := *e.loc
+		loc.Path = policy.Generalize(loc.Path, depth)
+		if err := p.Add(loc.Namespace, loc.DataPath(), "read"); err != nil {
+			return err
+		}
+	}
+	return p.WriteHCL(w)
+}